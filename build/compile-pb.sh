@@ -13,6 +13,9 @@ protoc --go_out=paths=source_relative:. --proto_path=protobuf/frontend/ cloudsta
 protoc --go-grpc_out=paths=source_relative:. --proto_path=protobuf/frontend/ cloudstate/eventing.proto
 protoc --go_out=paths=source_relative:. --proto_path=protobuf/frontend/ cloudstate/eventing.proto
 
+protoc --go_out=paths=source_relative:. --proto_path=protobuf/frontend/ --proto_path=protobuf/support/ cloudstate/projection/offset.proto
+protoc --go_out=paths=source_relative:. --proto_path=protobuf/support/ cloudstate/value/version.proto
+
 protoc --go-grpc_out=paths=source_relative:cloudstate/entity --proto_path=protobuf/protocol --proto_path=protobuf/protocol/cloudstate crdt.proto
 protoc --go_out=paths=source_relative:cloudstate/entity --proto_path=protobuf/protocol --proto_path=protobuf/protocol/cloudstate crdt.proto
 protoc --go-grpc_out=paths=source_relative:cloudstate/entity --proto_path=protobuf/protocol/ --proto_path=protobuf/protocol/cloudstate event_sourced.proto
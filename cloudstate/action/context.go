@@ -18,6 +18,7 @@ package action
 import (
 	"context"
 
+	"github.com/cloudstateio/go-support/cloudstate/cloudevents"
 	"github.com/cloudstateio/go-support/cloudstate/entity"
 	"github.com/cloudstateio/go-support/cloudstate/protocol"
 	"github.com/golang/protobuf/ptypes/any"
@@ -49,8 +50,7 @@ type Context struct {
 	// an action response.
 	cancel CancelFunc
 	// close is called whenever a client closes a stream.
-	close     CloseFunc
-	cancelled bool
+	close CloseFunc
 }
 
 func (c *Context) RespondWith(response *any.Any) {
@@ -65,6 +65,13 @@ func (c *Context) Forward(forward *protocol.Forward) {
 	c.forward = forward
 }
 
+// Fail sets a failure to be sent as the response of a streamed command.
+func (c *Context) Fail(err error) {
+	c.failure = err
+	c.response = nil
+	c.forward = nil
+}
+
 func (c *Context) SideEffect(effect *protocol.SideEffect) {
 	c.sideEffects = append(c.sideEffects, effect)
 }
@@ -80,9 +87,10 @@ func (c *Context) CancellationFunc(cancel CancelFunc) {
 }
 
 // Cancel cancels server command streaming.
-func (c *Context) Cancel() {
-	c.cancelled = true
-}
+//
+// Deprecated: A streamed out command ends when its handler returns, Cancel
+// has no effect on it.
+func (c *Context) Cancel() {}
 
 func (c *Context) Command() *entity.ActionCommand {
 	return c.command
@@ -92,6 +100,22 @@ func (c *Context) Metadata() *protocol.Metadata {
 	return c.metadata
 }
 
+// CloudEvent returns the CloudEvent attributes of the command the context
+// is handling, as described by cloudevents.FromMetadata.
+func (c *Context) CloudEvent() (cloudevents.Event, error) {
+	return cloudevents.FromMetadata(c.metadata)
+}
+
+// StreamCtx returns the context.Context from the stream this context is
+// assigned to.
+func (c *Context) StreamCtx() context.Context {
+	return c.ctx
+}
+
+// Respond sends the reply, forward or failure set and the side effects
+// emitted as a response of a streamed command. A non-nil err is sent as a
+// failure. Respond blocks until the response is sent and returns the error
+// of the stream context if the stream is done.
 func (c *Context) Respond(err error) error {
 	if c.respond != nil {
 		c.failure = err
@@ -103,3 +127,16 @@ func (c *Context) Respond(err error) error {
 func (c *Context) respondFunc(respond RespondFunc) {
 	c.respond = respond
 }
+
+// pending returns true if a response is set but not sent.
+func (c *Context) pending() bool {
+	return c.failure != nil || c.response != nil || c.forward != nil || len(c.sideEffects) > 0
+}
+
+// resetResponse clears the response after it was sent.
+func (c *Context) resetResponse() {
+	c.failure = nil
+	c.response = nil
+	c.forward = nil
+	c.sideEffects = make([]*protocol.SideEffect, 0)
+}
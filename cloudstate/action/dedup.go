@@ -0,0 +1,270 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudstateio/go-support/cloudstate/cloudevents"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+)
+
+// Dedup drops unary commands redelivered with the id of a command handled
+// before. Commands are identified by a metadata value, the CloudEvent id by
+// default. The id of a command is reserved before the entity is invoked, so
+// that a duplicate delivered while the command is still being handled is
+// dropped as well. A duplicate is acknowledged by an empty response without
+// invoking the entity. Commands failing release their id, so that they are
+// handled again when redelivered.
+type Dedup struct {
+	// Store remembers the ids of commands handled. Setting it is mandatory.
+	Store DedupStore
+	// Key is the metadata key of the command ids. It defaults to ce-id.
+	Key string
+}
+
+// A DedupStore remembers the ids of commands handled. Reserve has to be
+// atomic, so that of commands delivered concurrently with the same id, only
+// one gets handled.
+type DedupStore interface {
+	// Reserve reserves the id for a command to be handled. It returns false
+	// if the id was reserved or recorded before.
+	Reserve(ctx context.Context, id string) (bool, error)
+	// Record records the id reserved, after its command was handled.
+	Record(ctx context.Context, id string) error
+	// Release releases the id reserved for a command that failed.
+	Release(ctx context.Context, id string) error
+}
+
+// id returns the id of a command with the given metadata, or an empty
+// string if it has none.
+func (d *Dedup) id(md *protocol.Metadata) string {
+	key := d.Key
+	if key == "" {
+		key = cloudevents.IDKey
+	}
+	for _, e := range md.GetEntries() {
+		if strings.EqualFold(e.GetKey(), key) {
+			return e.GetStringValue()
+		}
+	}
+	return ""
+}
+
+// MemoryStore is a DedupStore keeping ids in memory until their TTL passed.
+type MemoryStore struct {
+	ttl time.Duration
+
+	// mu protects the fields below.
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	reserved  map[string]struct{}
+	lastSweep time.Time
+}
+
+// NewMemoryStore returns a new memory store remembering ids for the given
+// TTL. A TTL of zero remembers ids forever.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		ttl:       ttl,
+		expires:   make(map[string]time.Time),
+		reserved:  make(map[string]struct{}),
+		lastSweep: time.Now(),
+	}
+}
+
+// Reserve reserves the id, if it is not reserved and was not recorded or
+// its TTL passed.
+func (s *MemoryStore) Reserve(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.reserved[id]; ok {
+		return false, nil
+	}
+	if expires, ok := s.expires[id]; ok && (s.ttl == 0 || time.Now().Before(expires)) {
+		return false, nil
+	}
+	s.reserved[id] = struct{}{}
+	return true, nil
+}
+
+// Record records the id. Expired ids are dropped at most once per TTL.
+func (s *MemoryStore) Record(_ context.Context, id string) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reserved, id)
+	s.expires[id] = now.Add(s.ttl)
+	if s.ttl > 0 && now.Sub(s.lastSweep) > s.ttl {
+		for id, expires := range s.expires {
+			if !now.Before(expires) {
+				delete(s.expires, id)
+			}
+		}
+		s.lastSweep = now
+	}
+	return nil
+}
+
+// Release releases the id reserved.
+func (s *MemoryStore) Release(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reserved, id)
+	return nil
+}
+
+// RingStore is a DedupStore keeping the most recent ids recorded in memory,
+// up to a fixed number of ids. Recording an id evicts the oldest one.
+type RingStore struct {
+	// mu protects the fields below.
+	mu       sync.Mutex
+	ids      map[string]struct{}
+	reserved map[string]struct{}
+	ring     []string
+	next     int
+}
+
+// NewRingStore returns a new ring store remembering up to size ids.
+func NewRingStore(size int) *RingStore {
+	return &RingStore{
+		ids:      make(map[string]struct{}, size),
+		reserved: make(map[string]struct{}),
+		ring:     make([]string, size),
+	}
+}
+
+// Reserve reserves the id, if it is not reserved and is not one of the ids
+// recorded most recently.
+func (s *RingStore) Reserve(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ids[id]; ok {
+		return false, nil
+	}
+	if _, ok := s.reserved[id]; ok {
+		return false, nil
+	}
+	s.reserved[id] = struct{}{}
+	return true, nil
+}
+
+// Record records the id, evicting the oldest id recorded if the ring is full.
+func (s *RingStore) Record(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reserved, id)
+	if _, ok := s.ids[id]; ok || len(s.ring) == 0 {
+		return nil
+	}
+	delete(s.ids, s.ring[s.next])
+	s.ring[s.next] = id
+	s.ids[id] = struct{}{}
+	s.next = (s.next + 1) % len(s.ring)
+	return nil
+}
+
+// Release releases the id reserved.
+func (s *RingStore) Release(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reserved, id)
+	return nil
+}
+
+// FileStore is a DedupStore keeping ids in memory and appending them to a
+// file, one per line, to be remembered when the file is opened again. Ids
+// are appended once recorded, ids reserved are kept in memory only.
+type FileStore struct {
+	// mu protects the fields below.
+	mu       sync.Mutex
+	file     *os.File
+	ids      map[string]struct{}
+	reserved map[string]struct{}
+}
+
+// OpenFileStore opens a file store with the file of the given name, which
+// is created if it does not exist.
+func OpenFileStore(name string) (*FileStore, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStore{file: f, ids: make(map[string]struct{}), reserved: make(map[string]struct{})}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		s.ids[scanner.Text()] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("reading of the dedup file %q failed: %w", name, err)
+	}
+	return s, nil
+}
+
+// Reserve reserves the id, if it is not reserved and was not recorded.
+func (s *FileStore) Reserve(_ context.Context, id string) (bool, error) {
+	if strings.ContainsAny(id, "\r\n") {
+		return false, errors.New("an id recorded by a file store must not contain line breaks")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ids[id]; ok {
+		return false, nil
+	}
+	if _, ok := s.reserved[id]; ok {
+		return false, nil
+	}
+	s.reserved[id] = struct{}{}
+	return true, nil
+}
+
+// Record records the id and appends it to the file.
+func (s *FileStore) Record(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reserved, id)
+	if _, ok := s.ids[id]; ok {
+		return nil
+	}
+	if _, err := s.file.WriteString(id + "\n"); err != nil {
+		return err
+	}
+	s.ids[id] = struct{}{}
+	return nil
+}
+
+// Release releases the id reserved.
+func (s *FileStore) Release(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reserved, id)
+	return nil
+}
+
+// Close closes the file of the store.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
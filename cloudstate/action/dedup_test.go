@@ -0,0 +1,252 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/metrics"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func TestDedup(t *testing.T) {
+	s := NewServer()
+	err := s.Register(&Entity{
+		ServiceName: "dedup",
+		EntityFunc:  func() EntityHandler { return respondingEntity{} },
+		Dedup:       &Dedup{Store: NewMemoryStore(0)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	command := func(id string) *entity.ActionCommand {
+		payload, err := encoding.MarshalAny(&wrappers.StringValue{Value: "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &entity.ActionCommand{
+			ServiceName: "dedup",
+			Name:        "Echo",
+			Payload:     payload,
+			Metadata: &protocol.Metadata{Entries: []*protocol.MetadataEntry{
+				{Key: "ce-id", Value: &protocol.MetadataEntry_StringValue{StringValue: id}},
+			}},
+		}
+	}
+	dropped := metrics.DuplicatesDropped("dedup")
+	for i, tc := range []struct {
+		id      string
+		handled bool
+	}{
+		{"1", true},
+		{"1", false},
+		{"2", true},
+		{"", true},
+		{"", true},
+	} {
+		r, err := s.HandleUnary(context.Background(), command(tc.id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.GetReply() != nil; got != tc.handled {
+			t.Fatalf("%d: handled = %v; want: %v", i, got, tc.handled)
+		}
+	}
+	if got, want := metrics.DuplicatesDropped("dedup"), dropped+1; got != want {
+		t.Fatalf("DuplicatesDropped() = %d; want: %d", got, want)
+	}
+	if err := s.Register(&Entity{ServiceName: "dedup-2", EntityFunc: func() EntityHandler { return respondingEntity{} }, Dedup: &Dedup{}}); err == nil {
+		t.Fatal("Register() should fail for a Dedup without a Store")
+	}
+}
+
+// gatedEntity fails commands with a payload of "fail" and blocks other
+// commands until its gate is closed.
+type gatedEntity struct {
+	invoked chan struct{}
+	gate    chan struct{}
+}
+
+func (e gatedEntity) HandleCommand(ctx *Context, _ string, msg proto.Message) error {
+	if msg.(*wrappers.StringValue).GetValue() == "fail" {
+		return protocol.ClientError{Err: errors.New("failed")}
+	}
+	e.invoked <- struct{}{}
+	<-e.gate
+	ctx.RespondWith(encoding.String("handled"))
+	return nil
+}
+
+func TestDedupReservesIDs(t *testing.T) {
+	e := gatedEntity{invoked: make(chan struct{}, 2), gate: make(chan struct{})}
+	s := NewServer()
+	err := s.Register(&Entity{
+		ServiceName: "dedup",
+		EntityFunc:  func() EntityHandler { return e },
+		Dedup:       &Dedup{Store: NewMemoryStore(0)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	command := func(value string) *entity.ActionCommand {
+		payload, err := encoding.MarshalAny(&wrappers.StringValue{Value: value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &entity.ActionCommand{
+			ServiceName: "dedup",
+			Name:        "Handle",
+			Payload:     payload,
+			Metadata: &protocol.Metadata{Entries: []*protocol.MetadataEntry{
+				{Key: "ce-id", Value: &protocol.MetadataEntry_StringValue{StringValue: "1"}},
+			}},
+		}
+	}
+	t.Run("a failed command is handled again", func(t *testing.T) {
+		r, err := s.HandleUnary(context.Background(), command("fail"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.GetFailure() == nil {
+			t.Fatalf("response = %v; want a failure", r)
+		}
+	})
+	t.Run("a duplicate delivered concurrently is dropped", func(t *testing.T) {
+		first := make(chan *entity.ActionResponse)
+		go func() {
+			r, _ := s.HandleUnary(context.Background(), command("a"))
+			first <- r
+		}()
+		<-e.invoked
+		r, err := s.HandleUnary(context.Background(), command("a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.GetReply() != nil {
+			t.Fatal("the duplicate should not have been handled")
+		}
+		close(e.gate)
+		if r := <-first; r.GetReply() == nil {
+			t.Fatalf("response = %v; want a reply", r)
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore(time.Millisecond)
+	ctx := context.Background()
+	if reserved, _ := s.Reserve(ctx, "1"); !reserved {
+		t.Fatal("Reserve() = false; want: true")
+	}
+	if reserved, _ := s.Reserve(ctx, "1"); reserved {
+		t.Fatal("Reserve() = true for a reserved id; want: false")
+	}
+	if err := s.Release(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if reserved, _ := s.Reserve(ctx, "1"); !reserved {
+		t.Fatal("Reserve() = false for a released id; want: true")
+	}
+	if err := s.Record(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if reserved, _ := s.Reserve(ctx, "1"); reserved {
+		t.Fatal("Reserve() = true for a recorded id; want: false")
+	}
+	time.Sleep(2 * time.Millisecond)
+	if reserved, _ := s.Reserve(ctx, "1"); !reserved {
+		t.Fatal("Reserve() = false for an expired id; want: true")
+	}
+	if err := s.Record(ctx, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(s.expires), 1; got != want {
+		t.Fatalf("len(expires) = %d; want: %d", got, want)
+	}
+}
+
+func TestRingStore(t *testing.T) {
+	s := NewRingStore(2)
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "3"} {
+		if reserved, _ := s.Reserve(ctx, id); !reserved {
+			t.Fatalf("Reserve(%q) = false; want: true", id)
+		}
+		if err := s.Record(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id, want := range map[string]bool{"1": true, "2": false, "3": false} {
+		if got, _ := s.Reserve(ctx, id); got != want {
+			t.Fatalf("Reserve(%q) = %v; want: %v", id, got, want)
+		}
+	}
+	if reserved, _ := s.Reserve(ctx, "1"); reserved {
+		t.Fatal("Reserve() = true for a reserved id; want: false")
+	}
+	if got, want := len(s.ids), 2; got != want {
+		t.Fatalf("len(ids) = %d; want: %d", got, want)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "dedup")
+	ctx := context.Background()
+	s, err := OpenFileStore(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		if reserved, err := s.Reserve(ctx, id); err != nil || !reserved {
+			t.Fatalf("Reserve(%q) = %v, %v; want: true, nil", id, reserved, err)
+		}
+	}
+	for _, id := range []string{"1", "2"} {
+		if err := s.Record(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Reserve(ctx, "3\n4"); err == nil {
+		t.Fatal("Reserve() should fail for an id with a line break")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = OpenFileStore(name); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for id, want := range map[string]bool{"1": false, "2": false, "3": true} {
+		if got, _ := s.Reserve(ctx, id); got != want {
+			t.Fatalf("Reserve(%q) = %v; want: %v", id, got, want)
+		}
+	}
+}
@@ -14,4 +14,12 @@
 // limitations under the License.
 
 // Package action implements the Cloudstate Action protocol.
+//
+// Streamed commands are handled by HandleCommand for every message received,
+// unless an entity implements StreamedInHandler, StreamedOutHandler or
+// StreamedHandler to handle the stream by a single invocation. For these,
+// the context.Context returned by Context.StreamCtx is done when the client
+// cancelled the stream or the handler returned. A protocol.ClientError
+// returned by such a handler is sent as a failure, any other error closes
+// the stream with that error.
 package action
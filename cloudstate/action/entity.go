@@ -16,6 +16,8 @@
 package action
 
 import (
+	"time"
+
 	"github.com/golang/protobuf/proto"
 )
 
@@ -25,6 +27,28 @@ type Entity struct {
 	ServiceName ServiceName
 	// EntityFunc creates a new entity.
 	EntityFunc func() EntityHandler
+	// CommandTimeout, if set, limits the time the handler of a unary command
+	// may take. The context returned by Context.StreamCtx has the deadline
+	// of the command. If a handler does not return in time, a failure is
+	// sent and the timeout is counted by the metrics package. The handler is
+	// not stopped though and keeps running in its goroutine, possibly still
+	// mutating the entity instance. Handlers should therefore return once
+	// the context is done.
+	CommandTimeout time.Duration
+	// MaxConcurrency, if set, limits the number of commands handled
+	// concurrently, a streamed command counting for the lifetime of its
+	// stream. Commands exceeding the limit wait for a command to finish.
+	MaxConcurrency int
+	// MaxQueueDepth is the number of commands allowed to wait if
+	// MaxConcurrency is set. Commands exceeding it are rejected with a
+	// codes.ResourceExhausted status.
+	MaxQueueDepth int
+	// RateLimit, if set, limits the rate of commands. Commands exceeding it
+	// are rejected with a codes.ResourceExhausted status.
+	RateLimit *RateLimit
+	// Dedup, if set, drops unary commands redelivered after they were
+	// handled, like events delivered at least once.
+	Dedup *Dedup
 }
 
 type EntityHandler interface {
@@ -0,0 +1,159 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cloudstateio/go-support/cloudstate/metrics"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxBuckets is the number of rate limit buckets kept before full buckets
+// are dropped.
+const maxBuckets = 10000
+
+// RateLimit limits the rate of commands by a token bucket.
+type RateLimit struct {
+	// Rate is the number of commands per second allowed on average.
+	Rate float64
+	// Burst is the number of commands allowed at once. It defaults to one.
+	Burst int
+	// Key, if set, is a metadata key, like one of an API key, the rate is
+	// limited by per value. Commands without that metadata share a bucket.
+	Key string
+}
+
+// limiter limits the commands of an entity by its MaxConcurrency,
+// MaxQueueDepth and RateLimit.
+type limiter struct {
+	service string
+	// slots has a capacity of the concurrency allowed.
+	slots chan struct{}
+	// queue has a capacity of the commands allowed to wait for a slot.
+	queue chan struct{}
+	rate  *RateLimit
+
+	// mu protects the fields below.
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(e *Entity) *limiter {
+	l := &limiter{service: e.ServiceName.String()}
+	if e.MaxConcurrency > 0 {
+		l.slots = make(chan struct{}, e.MaxConcurrency)
+		l.queue = make(chan struct{}, e.MaxQueueDepth)
+	}
+	if e.RateLimit != nil && e.RateLimit.Rate > 0 {
+		l.rate = e.RateLimit
+		l.buckets = make(map[string]*bucket)
+	}
+	return l
+}
+
+// acquire waits for a command with the given metadata to be allowed to run
+// and returns a function to be called when it is done. A command exceeding
+// the limits is rejected by a codes.ResourceExhausted status error.
+func (l *limiter) acquire(ctx context.Context, md *protocol.Metadata) (release func(), err error) {
+	if l.rate != nil && !l.take(l.key(md), time.Now()) {
+		return nil, l.reject("rate limit exceeded")
+	}
+	if l.slots == nil {
+		return func() {}, nil
+	}
+	release = func() { <-l.slots }
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	select {
+	case l.queue <- struct{}{}:
+	default:
+		return nil, l.reject("concurrency limit exceeded")
+	}
+	defer func() { <-l.queue }()
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+func (l *limiter) reject(reason string) error {
+	metrics.CommandRejected(l.service)
+	return status.Errorf(codes.ResourceExhausted, "%s for service: %q", reason, l.service)
+}
+
+func (l *limiter) key(md *protocol.Metadata) string {
+	if l.rate.Key == "" {
+		return ""
+	}
+	for _, e := range md.GetEntries() {
+		if e.GetKey() == l.rate.Key {
+			return e.GetStringValue()
+		}
+	}
+	return ""
+}
+
+// take takes a token of the bucket for key, if there is one.
+func (l *limiter) take(key string, now time.Time) bool {
+	burst := float64(l.rate.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.dropFull(now, burst)
+		}
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate.Rate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// dropFull drops buckets that are refilled, as they are as good as new.
+func (l *limiter) dropFull(now time.Time, burst float64) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate.Rate >= burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/metrics"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	l := newLimiter(&Entity{ServiceName: "limited", MaxConcurrency: 1, MaxQueueDepth: 1})
+	release, err := l.acquire(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan error)
+	go func() {
+		release, err := l.acquire(context.Background(), nil)
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+	// wait for the command to be queued.
+	for len(l.queue) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	rejected := metrics.CommandsRejected("limited")
+	if _, err := l.acquire(context.Background(), nil); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("acquire() = %v; want: %v", err, codes.ResourceExhausted)
+	}
+	if got, want := metrics.CommandsRejected("limited"), rejected+1; got != want {
+		t.Fatalf("CommandsRejected() = %d; want: %d", got, want)
+	}
+	release()
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	release, err = l.acquire(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	cancel()
+	if _, err := l.acquire(ctx, nil); status.Code(err) != codes.Canceled {
+		t.Fatalf("acquire() = %v; want: %v", err, codes.Canceled)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	l := newLimiter(&Entity{RateLimit: &RateLimit{Rate: 10, Burst: 2, Key: "api-key"}})
+	now := time.Now()
+	for i, tc := range []struct {
+		key   string
+		after time.Duration
+		taken bool
+	}{
+		{"a", 0, true},
+		{"a", 0, true},
+		{"a", 0, false},
+		{"b", 0, true},
+		{"a", 50 * time.Millisecond, false},
+		{"a", 100 * time.Millisecond, true},
+		{"a", 100 * time.Millisecond, false},
+	} {
+		if got := l.take(tc.key, now.Add(tc.after)); got != tc.taken {
+			t.Fatalf("%d: take(%q) = %v; want: %v", i, tc.key, got, tc.taken)
+		}
+	}
+
+	s := NewServer()
+	err := s.Register(&Entity{
+		ServiceName: "limited",
+		EntityFunc:  func() EntityHandler { return respondingEntity{} },
+		RateLimit:   &RateLimit{Rate: 0.001, Key: "api-key"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := encoding.MarshalAny(&wrappers.StringValue{Value: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	command := func(key string) *entity.ActionCommand {
+		return &entity.ActionCommand{
+			ServiceName: "limited",
+			Name:        "Echo",
+			Payload:     payload,
+			Metadata: &protocol.Metadata{Entries: []*protocol.MetadataEntry{
+				{Key: "api-key", Value: &protocol.MetadataEntry_StringValue{StringValue: key}},
+			}},
+		}
+	}
+	if _, err := s.HandleUnary(context.Background(), command("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.HandleUnary(context.Background(), command("a")); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("HandleUnary() = %v; want: %v", err, codes.ResourceExhausted)
+	}
+	if _, err := s.HandleUnary(context.Background(), command("b")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -20,11 +20,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"reflect"
-	"strings"
 	"sync"
 
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
 	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/internal/timeout"
+	"github.com/cloudstateio/go-support/cloudstate/metrics"
 	"github.com/cloudstateio/go-support/cloudstate/protocol"
 	"github.com/golang/protobuf/proto"
 )
@@ -45,6 +46,8 @@ type Server struct {
 	mu sync.RWMutex
 	// entities has descriptions of entities registered by service names
 	entities map[ServiceName]*Entity
+	// limiters limit the commands of entities registered.
+	limiters map[ServiceName]*limiter
 
 	// internal marker enforced by go-grpc.
 	entity.UnimplementedActionProtocolServer
@@ -53,6 +56,7 @@ type Server struct {
 func NewServer() *Server {
 	return &Server{
 		entities: make(map[ServiceName]*Entity),
+		limiters: make(map[ServiceName]*limiter),
 	}
 }
 
@@ -60,12 +64,16 @@ func (s *Server) Register(e *Entity) error {
 	if e.EntityFunc == nil {
 		return errors.New("the entity has to define an EntityFunc but did not")
 	}
+	if e.Dedup != nil && e.Dedup.Store == nil {
+		return errors.New("the entity dedup has to define a Store but did not")
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, ok := s.entities[e.ServiceName]; ok {
 		return fmt.Errorf("an entity with service name: %q is already registered", e.ServiceName)
 	}
 	s.entities[e.ServiceName] = e
+	s.limiters[e.ServiceName] = newLimiter(e)
 	return nil
 }
 
@@ -79,6 +87,15 @@ func (s *Server) entityFor(service ServiceName) (*Entity, error) {
 	return e, nil
 }
 
+// acquire waits for a command of the entity to be allowed to run by the
+// limits of the entity and returns a function to be called when it is done.
+func (s *Server) acquire(ctx context.Context, e *Entity, md *protocol.Metadata) (func(), error) {
+	s.mu.RLock()
+	l := s.limiters[e.ServiceName]
+	s.mu.RUnlock()
+	return l.acquire(ctx, md)
+}
+
 // HandleUnary handles an unary command. The input command will contain the
 // service name, command name, request metadata and the command payload. The
 // reply may contain a direct reply, a forward or a failure, and it may contain
@@ -88,6 +105,31 @@ func (s *Server) HandleUnary(ctx context.Context, command *entity.ActionCommand)
 	if err != nil {
 		return nil, err
 	}
+	release, err := s.acquire(ctx, e, command.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	var id string
+	recorded := false
+	if e.Dedup != nil {
+		if id = e.Dedup.id(command.Metadata); id != "" {
+			reserved, err := e.Dedup.Store.Reserve(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if !reserved {
+				metrics.DuplicateDropped(e.ServiceName.String())
+				return &entity.ActionResponse{}, nil
+			}
+			defer func() {
+				if !recorded {
+					// The command failed and gets handled again when redelivered.
+					_ = e.Dedup.Store.Release(ctx, id)
+				}
+			}()
+		}
+	}
 	r := runner{context: &Context{
 		Entity:      e,
 		Instance:    e.EntityFunc(),
@@ -96,13 +138,38 @@ func (s *Server) HandleUnary(ctx context.Context, command *entity.ActionCommand)
 		metadata:    command.Metadata,
 		sideEffects: make([]*protocol.SideEffect, 0),
 	}}
-	err = r.runCommand(command)
+	var cmdErr error
+	err = timeout.Run(ctx, e.CommandTimeout, func(ctx context.Context) {
+		r.context.ctx = ctx
+		cmdErr = r.runCommand(command)
+	})
+	if err == context.DeadlineExceeded {
+		// The handler still runs, its context is left behind.
+		metrics.CommandTimedOut(e.ServiceName.String())
+		return &entity.ActionResponse{
+			Response: &entity.ActionResponse_Failure{
+				Failure: &protocol.Failure{
+					Description: timeout.ErrCommandTimeout.Error(),
+				},
+			},
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = cmdErr
 	if err != nil && !errors.Is(err, protocol.ClientError{}) {
 		return nil, err
 	}
 	if err != nil {
 		r.context.failure = err
 	}
+	if id != "" && r.context.failure == nil {
+		if err := e.Dedup.Store.Record(ctx, id); err != nil {
+			return nil, err
+		}
+		recorded = true
+	}
 	return r.actionResponse()
 }
 
@@ -137,6 +204,11 @@ func (s *Server) HandleStreamedIn(stream entity.ActionProtocol_HandleStreamedInS
 	if err != nil {
 		return err
 	}
+	release, err := s.acquire(stream.Context(), e, first.Metadata)
+	if err != nil {
+		return err
+	}
+	defer release()
 	r := runner{context: &Context{
 		Entity:      e,
 		Instance:    e.EntityFunc(),
@@ -145,6 +217,9 @@ func (s *Server) HandleStreamedIn(stream entity.ActionProtocol_HandleStreamedInS
 		metadata:    first.Metadata,
 		sideEffects: make([]*protocol.SideEffect, 0),
 	}}
+	if h, ok := r.context.Instance.(StreamedInHandler); ok {
+		return r.handleStreamedIn(h, stream)
+	}
 	for {
 		cmd, err := stream.Recv()
 		if err == io.EOF {
@@ -180,6 +255,11 @@ func (s *Server) HandleStreamedIn(stream entity.ActionProtocol_HandleStreamedInS
 // stream to the client will be closed when the this stream is closed, with the
 // same status as this stream is closed with.
 //
+// The command handler is invoked once and sends responses by
+// Context.Respond until it returns. A response set but not sent when the
+// handler returns is sent as the last response, as is a protocol.ClientError
+// returned as a failure. Any other error closes the stream with that error.
+//
 // Either the client or the server may cancel the stream at any time,
 // cancellation is indicated through an HTTP2 stream RST message.
 func (s *Server) HandleStreamedOut(command *entity.ActionCommand, stream entity.ActionProtocol_HandleStreamedOutServer) error {
@@ -187,6 +267,11 @@ func (s *Server) HandleStreamedOut(command *entity.ActionCommand, stream entity.
 	if err != nil {
 		return err
 	}
+	release, err := s.acquire(stream.Context(), e, command.Metadata)
+	if err != nil {
+		return err
+	}
+	defer release()
 	r := runner{context: &Context{
 		Entity:      e,
 		Instance:    e.EntityFunc(),
@@ -195,31 +280,22 @@ func (s *Server) HandleStreamedOut(command *entity.ActionCommand, stream entity.
 		metadata:    command.Metadata,
 		sideEffects: make([]*protocol.SideEffect, 0),
 	}}
+	if h, ok := r.context.Instance.(StreamedOutHandler); ok {
+		return r.handleStreamedOut(h, stream)
+	}
+	// The handler is invoked once and owns the stream until it returns. Every
+	// response is sent by action.Context.Respond, blocking until it is sent.
+	send := r.sendFunc(stream.Send)
 	r.context.respondFunc(func(c *Context) error {
-		r.response, err = r.actionResponse()
-		if err != nil {
-			return err
-		}
-		if err = stream.Send(r.response); err != nil {
-			return err
-		}
-		r.response = nil
-		r.context.response = nil
-		r.context.forward = nil
-		r.context.failure = nil
-		r.context.sideEffects = make([]*protocol.SideEffect, 0)
-		return nil
+		return send(nil)
 	})
-	for {
-		// No matter what error runCommand returns here, we take it as an error
-		// to stop the stream as errors are sent through action.Context.Respond.
-		if err = r.runCommand(command); err != nil {
-			return err
-		}
-		if r.context.cancelled {
-			return nil
-		}
+	if err := r.handleError(r.runCommand(command)); err != nil {
+		return err
+	}
+	if r.context.pending() {
+		return send(nil)
 	}
+	return nil
 }
 
 // HandleStreamed handles a full duplex streamed command.
@@ -258,6 +334,11 @@ func (s *Server) HandleStreamed(stream entity.ActionProtocol_HandleStreamedServe
 	if err != nil {
 		return err
 	}
+	release, err := s.acquire(stream.Context(), e, first.Metadata)
+	if err != nil {
+		return err
+	}
+	defer release()
 	r := runner{context: &Context{
 		Entity:      e,
 		Instance:    e.EntityFunc(),
@@ -266,6 +347,9 @@ func (s *Server) HandleStreamed(stream entity.ActionProtocol_HandleStreamedServe
 		metadata:    first.Metadata,
 		sideEffects: make([]*protocol.SideEffect, 0),
 	}}
+	if h, ok := r.context.Instance.(StreamedHandler); ok {
+		return r.handleStreamed(h, stream)
+	}
 	r.context.respondFunc(func(c *Context) error {
 		r.response, err = r.actionResponse()
 		if err != nil {
@@ -275,10 +359,7 @@ func (s *Server) HandleStreamed(stream entity.ActionProtocol_HandleStreamedServe
 			return err
 		}
 		r.response = nil
-		r.context.failure = nil
-		r.context.response = nil
-		r.context.forward = nil
-		r.context.sideEffects = make([]*protocol.SideEffect, 0)
+		r.context.resetResponse()
 		return nil
 	})
 	for {
@@ -312,22 +393,20 @@ type runner struct {
 // runCommand responds with effects, a response, a forward or a
 // failure using the action.Context passed to the command handler.
 func (r *runner) runCommand(cmd *entity.ActionCommand) error {
-	// unmarshal the commands message
-	msgName := strings.TrimPrefix(cmd.GetPayload().GetTypeUrl(), "type.googleapis.com/")
-	if strings.HasPrefix(msgName, "json.cloudstate.io/") {
-		return r.context.Instance.HandleCommand(r.context, cmd.Name, cmd.Payload)
-	}
-	messageType := proto.MessageType(msgName)
-	message, ok := reflect.New(messageType.Elem()).Interface().(proto.Message)
-	if !ok {
-		return fmt.Errorf("messageType is no proto.Message: %v", messageType)
-	}
-	if err := proto.Unmarshal(cmd.Payload.Value, message); err != nil {
+	message, err := unmarshalCommand(cmd)
+	if err != nil {
 		return err
 	}
 	return r.context.Instance.HandleCommand(r.context, cmd.Name, message)
 }
 
+// unmarshalCommand unmarshals the commands message by the
+// encoding.DefaultRegistry. Messages serialized as JSON are returned as the
+// *any.Any received.
+func unmarshalCommand(cmd *entity.ActionCommand) (proto.Message, error) {
+	return encoding.DefaultRegistry.DecodeMessage(cmd.GetPayload())
+}
+
 // actionResponse returns an action response depending on the runners
 // current state.
 func (r *runner) actionResponse() (*entity.ActionResponse, error) {
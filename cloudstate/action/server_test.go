@@ -0,0 +1,67 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/metrics"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+// blockingEntity blocks until the deadline of the command passed.
+type blockingEntity struct{}
+
+func (blockingEntity) HandleCommand(ctx *Context, _ string, _ proto.Message) error {
+	<-ctx.StreamCtx().Done()
+	return ctx.StreamCtx().Err()
+}
+
+func TestCommandTimeout(t *testing.T) {
+	s := NewServer()
+	err := s.Register(&Entity{
+		ServiceName:    "blocking",
+		EntityFunc:     func() EntityHandler { return blockingEntity{} },
+		CommandTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := encoding.MarshalAny(&wrappers.StringValue{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeouts := metrics.CommandTimeouts("blocking")
+	r, err := s.HandleUnary(context.Background(), &entity.ActionCommand{
+		ServiceName: "blocking",
+		Name:        "Block",
+		Payload:     payload,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.GetFailure() == nil {
+		t.Fatalf("a failure should have been sent: %+v", r)
+	}
+	if got, want := metrics.CommandTimeouts("blocking"), timeouts+1; got != want {
+		t.Fatalf("CommandTimeouts() = %d; want: %d", got, want)
+	}
+}
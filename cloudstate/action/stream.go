@@ -0,0 +1,208 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// A SendFunc sends a response for a streamed command. A non-nil reply is
+// sent as a reply, otherwise the failure or forward set on the context is
+// sent, if any. The side effects emitted since the last response are sent
+// with it. A SendFunc blocks until the response is sent and returns an
+// error if it can't be sent, for example if the stream is done.
+type SendFunc func(reply proto.Message) error
+
+// A StreamedInHandler is implemented by entities handling streamed in
+// commands with a channel instead of having HandleCommand invoked for every
+// message received.
+type StreamedInHandler interface {
+	// HandleStreamedIn handles the messages of a command received by in.
+	// The channel is closed when the client closed its stream. The reply,
+	// forward or failure set on the context when HandleStreamedIn returns is
+	// sent as the single response of the command.
+	HandleStreamedIn(ctx *Context, name string, in <-chan proto.Message) error
+}
+
+// A StreamedOutHandler is implemented by entities handling streamed out
+// commands by a single invocation instead of having HandleCommand invoked
+// in a loop.
+type StreamedOutHandler interface {
+	// HandleStreamedOut handles the message of a command and sends any
+	// number of responses by send. The stream is closed when
+	// HandleStreamedOut returns.
+	HandleStreamedOut(ctx *Context, name string, msg proto.Message, send SendFunc) error
+}
+
+// A StreamedHandler is implemented by entities handling full duplex
+// streamed commands with a channel instead of having HandleCommand invoked
+// for every message received.
+type StreamedHandler interface {
+	// HandleStreamed handles the messages of a command received by in and
+	// sends any number of responses by send. The channel is closed when the
+	// client closed its stream. The stream is closed when HandleStreamed
+	// returns.
+	HandleStreamed(ctx *Context, name string, in <-chan proto.Message, send SendFunc) error
+}
+
+func (r *runner) handleStreamedIn(h StreamedInHandler, stream entity.ActionProtocol_HandleStreamedInServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	r.context.ctx = ctx
+	in := make(chan proto.Message)
+	errc := receive(ctx, cancel, stream.Recv, in)
+	err := h.HandleStreamedIn(r.context, r.context.command.Name, in)
+	if err := receiveError(errc); err != nil {
+		return err
+	}
+	if err := r.handleError(err); err != nil {
+		return err
+	}
+	response, err := r.actionResponse()
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(response)
+}
+
+func (r *runner) handleStreamedOut(h StreamedOutHandler, stream entity.ActionProtocol_HandleStreamedOutServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	r.context.ctx = ctx
+	msg, err := unmarshalCommand(r.context.command)
+	if err != nil {
+		return err
+	}
+	send := r.sendFunc(stream.Send)
+	if err := r.handleError(h.HandleStreamedOut(r.context, r.context.command.Name, msg, send)); err != nil {
+		return err
+	}
+	if r.context.pending() {
+		return send(nil)
+	}
+	return nil
+}
+
+func (r *runner) handleStreamed(h StreamedHandler, stream entity.ActionProtocol_HandleStreamedServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	r.context.ctx = ctx
+	in := make(chan proto.Message)
+	errc := receive(ctx, cancel, stream.Recv, in)
+	send := r.sendFunc(stream.Send)
+	err := h.HandleStreamed(r.context, r.context.command.Name, in, send)
+	if err := receiveError(errc); err != nil {
+		return err
+	}
+	if err := r.handleError(err); err != nil {
+		return err
+	}
+	if r.context.pending() {
+		return send(nil)
+	}
+	return nil
+}
+
+// handleError sets a client error as the failure to be sent and returns
+// any other error.
+func (r *runner) handleError(err error) error {
+	if err != nil && errors.Is(err, protocol.ClientError{}) {
+		r.context.Fail(err)
+		return nil
+	}
+	return err
+}
+
+// sendFunc returns a SendFunc sending responses by send, one at a time.
+func (r *runner) sendFunc(send func(*entity.ActionResponse) error) SendFunc {
+	var mu sync.Mutex
+	return func(reply proto.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := r.context.ctx.Err(); err != nil {
+			return err
+		}
+		if reply != nil {
+			payload, ok := reply.(*any.Any)
+			if !ok {
+				var err error
+				if payload, err = encoding.DefaultRegistry.Encode(reply); err != nil {
+					return err
+				}
+			}
+			r.context.RespondWith(payload)
+		}
+		response, err := r.actionResponse()
+		if err != nil {
+			return err
+		}
+		if err := send(response); err != nil {
+			return err
+		}
+		r.context.resetResponse()
+		return nil
+	}
+}
+
+// receive decodes the commands received by recv into in until the client
+// closes the stream or ctx is done. in is closed when receiving ends. Any
+// other error ending it cancels ctx and is sent to the channel returned.
+func receive(ctx context.Context, cancel context.CancelFunc, recv func() (*entity.ActionCommand, error), in chan<- proto.Message) <-chan error {
+	errc := make(chan error, 1)
+	go func() {
+		defer close(in)
+		for {
+			cmd, err := recv()
+			if err == io.EOF {
+				return
+			}
+			if err == nil {
+				var msg proto.Message
+				if msg, err = unmarshalCommand(cmd); err == nil {
+					select {
+					case in <- msg:
+						continue
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+			errc <- err
+			cancel()
+			return
+		}
+	}()
+	return errc
+}
+
+// receiveError returns the error receiving ended with, if any.
+func receiveError(errc <-chan error) error {
+	select {
+	case err := <-errc:
+		return err
+	default:
+		return nil
+	}
+}
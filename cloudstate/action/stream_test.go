@@ -0,0 +1,351 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+)
+
+// stream is an action protocol server stream receiving a fixed sequence of
+// commands and recording responses sent.
+type stream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	cancel context.CancelFunc
+	in     []*entity.ActionCommand
+	sent   []*entity.ActionResponse
+	closed *entity.ActionResponse
+}
+
+func (s *stream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *stream) Send(r *entity.ActionResponse) error {
+	s.sent = append(s.sent, r)
+	return nil
+}
+
+func (s *stream) SendAndClose(r *entity.ActionResponse) error {
+	s.closed = r
+	return nil
+}
+
+func (s *stream) Recv() (*entity.ActionCommand, error) {
+	if len(s.in) == 0 && s.cancel != nil {
+		// the client cancels the stream instead of closing it.
+		s.cancel()
+		return nil, s.ctx.Err()
+	}
+	if len(s.in) == 0 {
+		return nil, io.EOF
+	}
+	in := s.in[0]
+	s.in = s.in[1:]
+	return in, nil
+}
+
+func newStream(t *testing.T, values ...string) *stream {
+	t.Helper()
+	s := &stream{
+		ctx: context.Background(),
+		in:  []*entity.ActionCommand{{ServiceName: "streaming", Name: "Echo"}},
+	}
+	for _, v := range values {
+		payload, err := encoding.MarshalAny(&wrappers.StringValue{Value: v})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.in = append(s.in, &entity.ActionCommand{Payload: payload})
+	}
+	return s
+}
+
+func replies(t *testing.T, responses []*entity.ActionResponse) []string {
+	t.Helper()
+	values := make([]string, 0, len(responses))
+	for _, r := range responses {
+		if f := r.GetFailure(); f != nil {
+			values = append(values, "failure: "+f.GetDescription())
+			continue
+		}
+		v := &wrappers.StringValue{}
+		if err := encoding.UnmarshalAny(r.GetReply().GetPayload(), v); err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, v.GetValue())
+	}
+	return values
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// streamingEntity echoes the values received.
+type streamingEntity struct{}
+
+func (streamingEntity) HandleCommand(*Context, string, proto.Message) error {
+	return errors.New("HandleCommand should not be called")
+}
+
+func (streamingEntity) HandleStreamedIn(ctx *Context, _ string, in <-chan proto.Message) error {
+	var joined string
+	for msg := range in {
+		joined += msg.(*wrappers.StringValue).GetValue()
+	}
+	reply, err := encoding.MarshalAny(&wrappers.StringValue{Value: joined})
+	ctx.RespondWith(reply)
+	return err
+}
+
+func (streamingEntity) HandleStreamedOut(ctx *Context, _ string, msg proto.Message, send SendFunc) error {
+	for _, r := range msg.(*wrappers.StringValue).GetValue() {
+		if r == '!' {
+			return protocol.ClientError{Err: errors.New("stop")}
+		}
+		if err := send(&wrappers.StringValue{Value: string(r)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (streamingEntity) HandleStreamed(ctx *Context, _ string, in <-chan proto.Message, send SendFunc) error {
+	for {
+		select {
+		case msg, ok := <-in:
+			if !ok {
+				return nil
+			}
+			if err := send(msg); err != nil {
+				return err
+			}
+		case <-ctx.StreamCtx().Done():
+			return ctx.StreamCtx().Err()
+		}
+	}
+}
+
+func newServer(t *testing.T) *Server {
+	t.Helper()
+	s := NewServer()
+	err := s.Register(&Entity{
+		ServiceName: "streaming",
+		EntityFunc:  func() EntityHandler { return streamingEntity{} },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestStreamedHandlers(t *testing.T) {
+	t.Run("streamed in", func(t *testing.T) {
+		s := newStream(t, "a", "b", "c")
+		if err := newServer(t).HandleStreamedIn(s); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := replies(t, []*entity.ActionResponse{s.closed}), []string{"abc"}; !equal(got, want) {
+			t.Fatalf("replies = %v; want: %v", got, want)
+		}
+	})
+
+	t.Run("streamed out", func(t *testing.T) {
+		s := newStream(t, "abc")
+		command := s.in[1]
+		command.ServiceName, command.Name = "streaming", "Echo"
+		if err := newServer(t).HandleStreamedOut(command, s); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := replies(t, s.sent), []string{"a", "b", "c"}; !equal(got, want) {
+			t.Fatalf("replies = %v; want: %v", got, want)
+		}
+	})
+
+	t.Run("streamed out failure", func(t *testing.T) {
+		s := newStream(t, "a!b")
+		command := s.in[1]
+		command.ServiceName, command.Name = "streaming", "Echo"
+		if err := newServer(t).HandleStreamedOut(command, s); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := replies(t, s.sent), []string{"a", "failure: stop"}; !equal(got, want) {
+			t.Fatalf("replies = %v; want: %v", got, want)
+		}
+	})
+
+	t.Run("streamed", func(t *testing.T) {
+		s := newStream(t, "a", "b")
+		if err := newServer(t).HandleStreamed(s); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := replies(t, s.sent), []string{"a", "b"}; !equal(got, want) {
+			t.Fatalf("replies = %v; want: %v", got, want)
+		}
+	})
+
+	t.Run("streamed cancelled", func(t *testing.T) {
+		s := newStream(t, "a")
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+		if err := newServer(t).HandleStreamed(s); err == nil {
+			t.Fatal("HandleStreamed() = nil; want an error")
+		}
+	})
+}
+
+// effectEntity sets a forward and a side effect without sending them.
+type effectEntity struct {
+	streamingEntity
+}
+
+func (effectEntity) setEffects(ctx *Context) {
+	ctx.Forward(&protocol.Forward{ServiceName: "other", CommandName: "Forwarded"})
+	ctx.SideEffect(&protocol.SideEffect{ServiceName: "other", CommandName: "Effect"})
+}
+
+func (e effectEntity) HandleStreamedOut(ctx *Context, _ string, _ proto.Message, _ SendFunc) error {
+	e.setEffects(ctx)
+	return nil
+}
+
+func (e effectEntity) HandleStreamed(ctx *Context, _ string, in <-chan proto.Message, _ SendFunc) error {
+	for range in {
+	}
+	e.setEffects(ctx)
+	return nil
+}
+
+func TestStreamedHandlersSendPendingResponses(t *testing.T) {
+	s := NewServer()
+	err := s.Register(&Entity{
+		ServiceName: "streaming",
+		EntityFunc:  func() EntityHandler { return effectEntity{} },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(t *testing.T, sent []*entity.ActionResponse) {
+		t.Helper()
+		if got, want := len(sent), 1; got != want {
+			t.Fatalf("len(sent) = %d; want: %d", got, want)
+		}
+		if got, want := sent[0].GetForward().GetCommandName(), "Forwarded"; got != want {
+			t.Fatalf("forward command = %q; want: %q", got, want)
+		}
+		if got, want := len(sent[0].GetSideEffects()), 1; got != want {
+			t.Fatalf("len(sideEffects) = %d; want: %d", got, want)
+		}
+	}
+
+	t.Run("streamed out", func(t *testing.T) {
+		st := newStream(t, "a")
+		command := st.in[1]
+		command.ServiceName, command.Name = "streaming", "Echo"
+		if err := s.HandleStreamedOut(command, st); err != nil {
+			t.Fatal(err)
+		}
+		check(t, st.sent)
+	})
+
+	t.Run("streamed", func(t *testing.T) {
+		st := newStream(t, "a")
+		if err := s.HandleStreamed(st); err != nil {
+			t.Fatal(err)
+		}
+		check(t, st.sent)
+	})
+}
+
+// respondingEntity responds with every rune of the value received, the last
+// one left to be sent when it returns.
+type respondingEntity struct{}
+
+func (respondingEntity) HandleCommand(ctx *Context, _ string, msg proto.Message) error {
+	for i, r := range msg.(*wrappers.StringValue).GetValue() {
+		reply, err := encoding.MarshalAny(&wrappers.StringValue{Value: string(r)})
+		if err != nil {
+			return err
+		}
+		ctx.RespondWith(reply)
+		if i == len(msg.(*wrappers.StringValue).GetValue())-1 {
+			break
+		}
+		if err := ctx.Respond(nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestHandleStreamedOut(t *testing.T) {
+	newServer := func(t *testing.T) *Server {
+		s := NewServer()
+		err := s.Register(&Entity{
+			ServiceName: "streaming",
+			EntityFunc:  func() EntityHandler { return respondingEntity{} },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	t.Run("the handler is invoked once", func(t *testing.T) {
+		s := newStream(t, "abc")
+		command := s.in[1]
+		command.ServiceName, command.Name = "streaming", "Echo"
+		if err := newServer(t).HandleStreamedOut(command, s); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := replies(t, s.sent), []string{"a", "b", "c"}; !equal(got, want) {
+			t.Fatalf("replies = %v; want: %v", got, want)
+		}
+	})
+
+	t.Run("responses are not sent when the stream is done", func(t *testing.T) {
+		s := newStream(t, "abc")
+		var cancel context.CancelFunc
+		s.ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		command := s.in[1]
+		command.ServiceName, command.Name = "streaming", "Echo"
+		if err := newServer(t).HandleStreamedOut(command, s); err != context.Canceled {
+			t.Fatalf("HandleStreamedOut() = %v; want: %v", err, context.Canceled)
+		}
+		if got := len(s.sent); got != 0 {
+			t.Fatalf("len(sent) = %d; want: 0", got)
+		}
+	})
+}
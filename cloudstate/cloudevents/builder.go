@@ -0,0 +1,63 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudevents
+
+import (
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// Reply returns a reply of the given payload with the event attached. It
+// returns an error if the event is not valid.
+func Reply(e Event, payload *any.Any) (*protocol.Reply, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return &protocol.Reply{
+		Payload:  payload,
+		Metadata: e.Metadata(nil),
+	}, nil
+}
+
+// Forward returns a forward of the given payload to a command of a service
+// with the event attached. It returns an error if the event is not valid.
+func Forward(e Event, service, command string, payload *any.Any) (*protocol.Forward, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return &protocol.Forward{
+		ServiceName: service,
+		CommandName: command,
+		Payload:     payload,
+		Metadata:    e.Metadata(nil),
+	}, nil
+}
+
+// SideEffect returns a side effect of the given payload to a command of a
+// service with the event attached. It returns an error if the event is not
+// valid.
+func SideEffect(e Event, service, command string, payload *any.Any, synchronous bool) (*protocol.SideEffect, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return &protocol.SideEffect{
+		ServiceName: service,
+		CommandName: command,
+		Payload:     payload,
+		Synchronous: synchronous,
+		Metadata:    e.Metadata(nil),
+	}, nil
+}
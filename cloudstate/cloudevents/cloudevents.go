@@ -0,0 +1,157 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cloudevents maps CloudEvents to the metadata of Cloudstate
+// commands, replies, forwards and side effects, in the binary content mode
+// of the CloudEvents gRPC and HTTP protocol bindings, and decodes events
+// delivered in the structured content mode as JSON.
+package cloudevents
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+)
+
+// SpecVersion is the CloudEvents specification version supported.
+const SpecVersion = "1.0"
+
+// Metadata keys of the CloudEvent attributes.
+const (
+	IDKey              = "ce-id"
+	SourceKey          = "ce-source"
+	TypeKey            = "ce-type"
+	SubjectKey         = "ce-subject"
+	TimeKey            = "ce-time"
+	SpecVersionKey     = "ce-specversion"
+	DataContentTypeKey = "ce-datacontenttype"
+)
+
+// Event holds the attributes of a CloudEvent.
+type Event struct {
+	ID              string
+	Source          string
+	Type            string
+	Subject         string
+	Time            time.Time
+	SpecVersion     string
+	DataContentType string
+}
+
+// New returns an event of the current specification version with the given
+// required attributes.
+func New(id, source, eventType string) Event {
+	return Event{ID: id, Source: source, Type: eventType, SpecVersion: SpecVersion}
+}
+
+// FromMetadata returns the event described by the CloudEvent attributes of
+// the given metadata. It returns an error if the ce-time attribute is no
+// RFC 3339 timestamp, along with all other attributes. FromMetadata does not
+// validate the event, use Event.Validate to do so.
+func FromMetadata(md *protocol.Metadata) (Event, error) {
+	var e Event
+	var err error
+	for _, entry := range md.GetEntries() {
+		value := entry.GetStringValue()
+		switch strings.ToLower(entry.GetKey()) {
+		case IDKey:
+			e.ID = value
+		case SourceKey:
+			e.Source = value
+		case TypeKey:
+			e.Type = value
+		case SubjectKey:
+			e.Subject = value
+		case SpecVersionKey:
+			e.SpecVersion = value
+		case DataContentTypeKey:
+			e.DataContentType = value
+		case TimeKey:
+			t, timeErr := time.Parse(time.RFC3339Nano, value)
+			if timeErr != nil {
+				err = fmt.Errorf("invalid CloudEvent attribute %s: %w", TimeKey, timeErr)
+				continue
+			}
+			e.Time = t
+		}
+	}
+	return e, err
+}
+
+// Validate returns an error if a required attribute of the event is
+// missing or if the event has an unsupported specification version.
+func (e Event) Validate() error {
+	var missing []string
+	for _, a := range []struct{ key, value string }{
+		{IDKey, e.ID},
+		{SourceKey, e.Source},
+		{TypeKey, e.Type},
+		{SpecVersionKey, e.SpecVersion},
+	} {
+		if a.value == "" {
+			missing = append(missing, a.key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing CloudEvent attributes: %s", strings.Join(missing, ", "))
+	}
+	if e.SpecVersion != SpecVersion {
+		return fmt.Errorf("unsupported CloudEvent spec version: %q", e.SpecVersion)
+	}
+	return nil
+}
+
+// IsZero returns true if the event has no attributes set, as for metadata
+// not describing a CloudEvent.
+func (e Event) IsZero() bool {
+	return e == Event{}
+}
+
+// Metadata returns the metadata given with the attributes of the event set,
+// replacing any CloudEvent attributes it had. The metadata given is not
+// modified and may be nil.
+func (e Event) Metadata(md *protocol.Metadata) *protocol.Metadata {
+	out := &protocol.Metadata{}
+	for _, entry := range md.GetEntries() {
+		if !strings.HasPrefix(strings.ToLower(entry.GetKey()), "ce-") {
+			out.Entries = append(out.Entries, entry)
+		}
+	}
+	for _, a := range []struct{ key, value string }{
+		{SpecVersionKey, e.SpecVersion},
+		{IDKey, e.ID},
+		{TypeKey, e.Type},
+		{SourceKey, e.Source},
+		{SubjectKey, e.Subject},
+		{DataContentTypeKey, e.DataContentType},
+	} {
+		if a.value != "" {
+			out.Entries = append(out.Entries, stringEntry(a.key, a.value))
+		}
+	}
+	if !e.Time.IsZero() {
+		out.Entries = append(out.Entries, stringEntry(TimeKey, e.Time.UTC().Format(time.RFC3339Nano)))
+	}
+	return out
+}
+
+func stringEntry(key, value string) *protocol.MetadataEntry {
+	return &protocol.MetadataEntry{
+		Key:   key,
+		Value: &protocol.MetadataEntry_StringValue{StringValue: value},
+	}
+}
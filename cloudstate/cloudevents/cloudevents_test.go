@@ -0,0 +1,146 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudevents
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+func metadata(entries ...string) *protocol.Metadata {
+	md := &protocol.Metadata{}
+	for i := 0; i < len(entries); i += 2 {
+		md.Entries = append(md.Entries, stringEntry(entries[i], entries[i+1]))
+	}
+	return md
+}
+
+func TestFromMetadata(t *testing.T) {
+	md := metadata(
+		"ce-specversion", "1.0",
+		"ce-id", "cart-1-3",
+		"Ce-Source", "com.example.Cart",
+		"ce-type", "ItemAdded",
+		"ce-subject", "cart-1",
+		"ce-time", "2020-11-05T10:00:00Z",
+		"ce-datacontenttype", "application/protobuf",
+		"x-other", "other",
+	)
+	e, err := FromMetadata(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Event{
+		ID:              "cart-1-3",
+		Source:          "com.example.Cart",
+		Type:            "ItemAdded",
+		Subject:         "cart-1",
+		Time:            time.Date(2020, 11, 5, 10, 0, 0, 0, time.UTC),
+		SpecVersion:     "1.0",
+		DataContentType: "application/protobuf",
+	}
+	if e != want {
+		t.Fatalf("FromMetadata() = %+v; want: %+v", e, want)
+	}
+	if err := e.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	roundtrip, err := FromMetadata(e.Metadata(metadata("x-other", "other", "ce-id", "replaced")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roundtrip != want {
+		t.Fatalf("FromMetadata(Metadata()) = %+v; want: %+v", roundtrip, want)
+	}
+
+	if _, err := FromMetadata(metadata("ce-time", "yesterday")); err == nil {
+		t.Fatal("FromMetadata() = nil; want an error for an invalid time")
+	}
+	if e, _ := FromMetadata(nil); !e.IsZero() {
+		t.Fatalf("FromMetadata(nil) = %+v; want a zero event", e)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, e := range []Event{
+		{},
+		{ID: "1", Source: "source", Type: "type"},
+		{ID: "1", Source: "source", Type: "type", SpecVersion: "0.3"},
+	} {
+		if err := e.Validate(); err == nil {
+			t.Fatalf("%+v should not be valid", e)
+		}
+	}
+}
+
+func TestBuilders(t *testing.T) {
+	e := New("1", "com.example.Source", "com.example.Type")
+	r, err := Reply(e, &any.Any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := FromMetadata(r.GetMetadata()); got != e {
+		t.Fatalf("reply event = %+v; want: %+v", got, e)
+	}
+	if _, err := Forward(Event{}, "service", "command", &any.Any{}); err == nil {
+		t.Fatal("Forward() should fail for an invalid event")
+	}
+	s, err := SideEffect(e, "service", "command", &any.Any{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := FromMetadata(s.GetMetadata()); got != e || !s.GetSynchronous() {
+		t.Fatalf("side effect = %+v; want event: %+v", s, e)
+	}
+}
+
+func TestDecodeStructured(t *testing.T) {
+	if !IsStructured(metadata("Content-Type", "application/cloudevents+json; charset=utf-8")) {
+		t.Fatal("IsStructured() = false; want: true")
+	}
+	if IsStructured(metadata("content-type", "application/json")) {
+		t.Fatal("IsStructured() = true; want: false")
+	}
+
+	doc := `{"specversion":"1.0","id":"1","source":"s","type":"t","data":{"message":"hi"}}`
+	e, data, err := DecodeStructured(&any.Any{TypeUrl: "cloudevent", Value: []byte(doc)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e != New("1", "s", "t") || string(data) != `{"message":"hi"}` {
+		t.Fatalf("DecodeStructured() = %+v, %s", e, data)
+	}
+
+	payload, err := encoding.MarshalJSON(structured{
+		SpecVersion: "1.0", ID: "2", Source: "s", Type: "t",
+		DataBase64: base64.StdEncoding.EncodeToString([]byte("binary")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, data, err = DecodeStructured(payload); err != nil || string(data) != "binary" {
+		t.Fatalf("DecodeStructured() = %s, %v; want: binary", data, err)
+	}
+
+	if _, _, err := DecodeStructured(&any.Any{Value: []byte(`{"id":"1"}`)}); err == nil {
+		t.Fatal("DecodeStructured() should fail for an invalid event")
+	}
+}
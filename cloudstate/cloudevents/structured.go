@@ -0,0 +1,100 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudevents
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// ContentType is the media type of events in the structured content mode.
+const ContentType = "application/cloudevents+json"
+
+// structured is the JSON format of an event.
+type structured struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+// IsStructured returns true if the metadata declares a content type of
+// ContentType, as for events delivered in the structured content mode.
+func IsStructured(md *protocol.Metadata) bool {
+	for _, entry := range md.GetEntries() {
+		if strings.ToLower(entry.GetKey()) != "content-type" {
+			continue
+		}
+		t, _, err := mime.ParseMediaType(entry.GetStringValue())
+		return err == nil && t == ContentType
+	}
+	return false
+}
+
+// DecodeStructured decodes an event delivered in the structured content mode
+// as JSON. The payload is either serialized as JSON by the encoding package
+// or holds the JSON document as its value. DecodeStructured returns the
+// event and its data, the JSON value of its data attribute or the decoded
+// value of its data_base64 attribute. The event is validated.
+func DecodeStructured(payload *any.Any) (Event, []byte, error) {
+	var s structured
+	var err error
+	if strings.HasPrefix(payload.GetTypeUrl(), encoding.JSONTypeURLPrefix) {
+		err = encoding.UnmarshalJSON(payload, &s)
+	} else {
+		err = json.Unmarshal(payload.GetValue(), &s)
+	}
+	if err != nil {
+		return Event{}, nil, fmt.Errorf("decoding of the structured CloudEvent failed: %w", err)
+	}
+	e := Event{
+		ID:              s.ID,
+		Source:          s.Source,
+		Type:            s.Type,
+		Subject:         s.Subject,
+		SpecVersion:     s.SpecVersion,
+		DataContentType: s.DataContentType,
+	}
+	if s.Time != "" {
+		if e.Time, err = time.Parse(time.RFC3339Nano, s.Time); err != nil {
+			return e, nil, fmt.Errorf("invalid CloudEvent attribute time: %w", err)
+		}
+	}
+	if err := e.Validate(); err != nil {
+		return e, nil, err
+	}
+	if s.DataBase64 != "" {
+		data, err := base64.StdEncoding.DecodeString(s.DataBase64)
+		if err != nil {
+			return e, nil, fmt.Errorf("invalid CloudEvent attribute data_base64: %w", err)
+		}
+		return e, data, nil
+	}
+	return e, s.Data, nil
+}
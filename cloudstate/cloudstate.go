@@ -62,6 +62,9 @@ func New(c protocol.Config) (*CloudState, error) {
 
 // RegisterEventSourced registers an event sourced entity.
 func (cs *CloudState) RegisterEventSourced(entity *eventsourced.Entity, config protocol.DescriptorConfig) error {
+	if err := validateEventPublisher(entity); err != nil {
+		return err
+	}
 	if err := cs.eventSourcedServer.Register(entity); err != nil {
 		return err
 	}
@@ -0,0 +1,77 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdt
+
+import (
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// A Path is a path of ORMap keys to a CRDT nested in ORMaps. The empty path
+// is the path of the root CRDT of an entity.
+type Path []*any.Any
+
+// Changes are the parts of a CRDT changed by a delta.
+type Changes struct {
+	// all is set if the CRDT changed as a whole.
+	all bool
+	// keys has the changes of ORMap values by their key.
+	keys map[anyKey]*Changes
+}
+
+// Touches returns true if the CRDT at path, a CRDT nested in it or one it
+// is nested in has changed.
+func (c *Changes) Touches(path Path) bool {
+	for _, key := range path {
+		if c == nil || c.all {
+			break
+		}
+		c = c.keys[keyOf(key)]
+	}
+	return c != nil
+}
+
+// changesOf returns the changes of a CRDT by delta.
+func changesOf(delta *entity.CrdtDelta) *Changes {
+	if delta == nil {
+		return nil
+	}
+	d := delta.GetOrmap()
+	if d == nil || d.GetCleared() {
+		return &Changes{all: true}
+	}
+	c := &Changes{keys: make(map[anyKey]*Changes)}
+	for _, key := range d.GetRemoved() {
+		c.keys[keyOf(key)] = &Changes{all: true}
+	}
+	for _, e := range d.GetAdded() {
+		c.keys[keyOf(e.GetKey())] = &Changes{all: true}
+	}
+	for _, e := range d.GetUpdated() {
+		if changes := changesOf(e.GetDelta()); changes != nil {
+			c.keys[keyOf(e.GetKey())] = changes
+		}
+	}
+	return c
+}
+
+// changesOfAction returns the changes of a CRDT by a state action.
+func changesOfAction(action *entity.CrdtStateAction) *Changes {
+	if action.GetDelete() != nil {
+		return &Changes{all: true}
+	}
+	return changesOf(action.GetUpdate())
+}
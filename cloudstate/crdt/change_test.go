@@ -0,0 +1,195 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdt
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+)
+
+func TestChanges(t *testing.T) {
+	a, b, c := encoding.String("a"), encoding.String("b"), encoding.String("c")
+	changes := changesOf(&entity.CrdtDelta{Delta: &entity.CrdtDelta_Ormap{Ormap: &entity.ORMapDelta{
+		Removed: []*any.Any{c},
+		Updated: []*entity.ORMapEntryDelta{{
+			Key: a,
+			Delta: &entity.CrdtDelta{Delta: &entity.CrdtDelta_Ormap{Ormap: &entity.ORMapDelta{
+				Updated: []*entity.ORMapEntryDelta{{
+					Key:   b,
+					Delta: &entity.CrdtDelta{Delta: &entity.CrdtDelta_Gcounter{Gcounter: &entity.GCounterDelta{Increment: 1}}},
+				}},
+			}}},
+		}},
+	}}})
+	for _, tc := range []struct {
+		path Path
+		want bool
+	}{
+		{Path{}, true},
+		{Path{a}, true},
+		{Path{a, b}, true},
+		{Path{a, b, c}, true},
+		{Path{a, c}, false},
+		{Path{b}, false},
+		{Path{c}, true},
+		{Path{c, a}, true},
+	} {
+		if got := changes.Touches(tc.path); got != tc.want {
+			t.Errorf("Touches(%v) = %v; want: %v", tc.path, got, tc.want)
+		}
+	}
+	cleared := changesOf(&entity.CrdtDelta{Delta: &entity.CrdtDelta_Ormap{Ormap: &entity.ORMapDelta{Cleared: true}}})
+	if !cleared.Touches(Path{b}) {
+		t.Error("a cleared ORMap should touch all keys")
+	}
+	empty := &any.Any{TypeUrl: encoding.PrimitiveTypeURLPrefixString, Value: []byte{1<<3 | proto.WireBytes, 0}}
+	removed := changesOf(&entity.CrdtDelta{Delta: &entity.CrdtDelta_Ormap{Ormap: &entity.ORMapDelta{
+		Removed: []*any.Any{empty},
+	}}})
+	if !removed.Touches(Path{encoding.String("")}) {
+		t.Error("a key should touch the path of an equal key encoded differently")
+	}
+	var none *Changes
+	if none.Touches(Path{}) {
+		t.Error("no changes should touch nothing")
+	}
+}
+
+// stream is a entity.Crdt_HandleServer receiving a fixed sequence of
+// messages and recording messages sent.
+type stream struct {
+	grpc.ServerStream
+	in   []*entity.CrdtStreamIn
+	sent []*entity.CrdtStreamOut
+}
+
+func (s *stream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *stream) Send(out *entity.CrdtStreamOut) error {
+	s.sent = append(s.sent, out)
+	return nil
+}
+
+func (s *stream) Recv() (*entity.CrdtStreamIn, error) {
+	if len(s.in) == 0 {
+		return nil, io.EOF
+	}
+	in := s.in[0]
+	s.in = s.in[1:]
+	return in, nil
+}
+
+// watchingEntity has GCounters by keys and watches them by streamed
+// commands.
+type watchingEntity struct {
+	m *ORMap
+}
+
+func (e *watchingEntity) HandleCommand(ctx *CommandContext, name string, msg proto.Message) (*any.Any, error) {
+	key := encoding.String(msg.(*wrappers.StringValue).GetValue())
+	switch name {
+	case "Watch":
+		ctx.ChangeFuncFor(Path{key}, func(*CommandContext) (*any.Any, error) {
+			return key, nil
+		})
+	case "Increment":
+		c, err := e.m.GCounter(key)
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			c = NewGCounter()
+			e.m.Set(key, c)
+		}
+		c.Increment(1)
+	}
+	return key, nil
+}
+
+func (e *watchingEntity) Default(*Context) (CRDT, error) {
+	return NewORMap(), nil
+}
+
+func (e *watchingEntity) Set(_ *Context, state CRDT) error {
+	e.m = state.(*ORMap)
+	return nil
+}
+
+func TestChangeFuncFor(t *testing.T) {
+	s := &stream{in: []*entity.CrdtStreamIn{{
+		Message: &entity.CrdtStreamIn_Init{Init: &entity.CrdtInit{ServiceName: "watching", EntityId: "entity-0"}},
+	}}}
+	for i, c := range []struct {
+		name, key string
+		streamed  bool
+	}{
+		{"Watch", "a", true},
+		{"Watch", "b", true},
+		{"Increment", "a", false},
+		{"Increment", "a", false},
+	} {
+		payload, err := encoding.MarshalAny(&wrappers.StringValue{Value: c.key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.in = append(s.in, &entity.CrdtStreamIn{Message: &entity.CrdtStreamIn_Command{Command: &protocol.Command{
+			EntityId: "entity-0",
+			Id:       int64(i + 1),
+			Name:     c.name,
+			Payload:  payload,
+			Streamed: c.streamed,
+		}}})
+	}
+	s.in = append(s.in, &entity.CrdtStreamIn{Message: &entity.CrdtStreamIn_Delta{Delta: &entity.CrdtDelta{
+		Delta: &entity.CrdtDelta_Ormap{Ormap: &entity.ORMapDelta{
+			Updated: []*entity.ORMapEntryDelta{{
+				Key:   encoding.String("b"),
+				Delta: &entity.CrdtDelta{Delta: &entity.CrdtDelta_Gcounter{Gcounter: &entity.GCounterDelta{Increment: 1}}},
+			}},
+		}},
+	}}})
+	server := NewServer()
+	err := server.Register(&Entity{
+		ServiceName: "watching",
+		EntityFunc:  func(EntityID) EntityHandler { return &watchingEntity{} },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Handle(s); err != nil {
+		t.Fatal(err)
+	}
+	var got []int64
+	for _, out := range s.sent {
+		if m := out.GetStreamedMessage(); m != nil {
+			got = append(got, m.GetCommandId())
+		}
+	}
+	if want := []int64{1, 1, 2}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("streamed messages for commands = %v; want: %v", got, want)
+	}
+}
@@ -16,14 +16,13 @@
 package crdt
 
 import (
+	"context"
 	"errors"
-	"fmt"
-	"reflect"
-	"strings"
 
+	"github.com/cloudstateio/go-support/cloudstate/cloudevents"
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
 	"github.com/cloudstateio/go-support/cloudstate/entity"
 	"github.com/cloudstateio/go-support/cloudstate/protocol"
-	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes/any"
 )
 
@@ -37,8 +36,10 @@ type CancelFunc func(c *CommandContext) error
 // values to handle a command over different phases of a commands lifecycle.
 type CommandContext struct {
 	*Context
-	CommandID   CommandID
-	change      ChangeFunc
+	CommandID CommandID
+	change    ChangeFunc
+	// changeIf, if set, selects the changes the change function is called for.
+	changeIf    func(*Changes) bool
 	cancel      CancelFunc
 	cmd         *protocol.Command
 	forward     *protocol.Forward
@@ -48,6 +49,18 @@ type CommandContext struct {
 	ended bool
 
 	writeConsistency entity.CrdtWriteConsistency
+	// deadline is the context of a command handled with a command timeout.
+	deadline context.Context
+}
+
+// StreamCtx returns the context.Context from the transport stream this
+// context is assigned to. While a command is handled with a CommandTimeout,
+// it has the deadline of the command.
+func (c *CommandContext) StreamCtx() context.Context {
+	if c.deadline != nil {
+		return c.deadline
+	}
+	return c.Context.StreamCtx()
 }
 
 // Command returns the protobuf message the context is handling as a command.
@@ -55,6 +68,12 @@ func (c *CommandContext) Command() *protocol.Command {
 	return c.cmd
 }
 
+// CloudEvent returns the CloudEvent attributes of the command the context
+// is handling, as described by cloudevents.FromMetadata.
+func (c *CommandContext) CloudEvent() (cloudevents.Event, error) {
+	return cloudevents.FromMetadata(c.cmd.GetMetadata())
+}
+
 // Streamed returns whether the command handled by the context is streamed.
 func (c *CommandContext) Streamed() bool {
 	if c.cmd == nil {
@@ -66,10 +85,28 @@ func (c *CommandContext) Streamed() bool {
 // ChangeFunc sets the function to be called whenever the CRDT is changed.
 // For non-streamed contexts this is a `no operation`.
 func (c *CommandContext) ChangeFunc(f ChangeFunc) {
+	c.ChangeFuncIf(nil, f)
+}
+
+// ChangeFuncFor sets the function to be called whenever the CRDT at path,
+// a CRDT nested in it or one it is nested in is changed.
+// For non-streamed contexts this is a `no operation`.
+func (c *CommandContext) ChangeFuncFor(path Path, f ChangeFunc) {
+	path = append(Path(nil), path...)
+	c.ChangeFuncIf(func(changes *Changes) bool {
+		return changes.Touches(path)
+	}, f)
+}
+
+// ChangeFuncIf sets the function to be called whenever the CRDT is changed
+// and pred returns true for the changes. A nil pred selects all changes.
+// For non-streamed contexts this is a `no operation`.
+func (c *CommandContext) ChangeFuncIf(pred func(*Changes) bool, f ChangeFunc) {
 	if !c.Streamed() {
 		return
 	}
 	c.change = f
+	c.changeIf = pred
 }
 
 // CancelFunc registers an on cancel handler for this command.
@@ -105,22 +142,17 @@ func (c *CommandContext) SideEffect(effect *protocol.SideEffect) {
 	c.sideEffects = append(c.sideEffects, effect)
 }
 
+// WriteConsistency sets the write consistency of the state action emitted
+// for this command, overriding the entities DefaultWriteConsistency. Within a
+// CancelFunc, it sets the write consistency of the state action emitted for
+// the cancellation.
 func (c *CommandContext) WriteConsistency(wc entity.CrdtWriteConsistency) {
 	c.writeConsistency = wc
 }
 
 func (c *CommandContext) runCommand(cmd *protocol.Command) (*any.Any, error) {
-	// unmarshal the commands message
-	msgName := strings.TrimPrefix(cmd.GetPayload().GetTypeUrl(), "type.googleapis.com/")
-	if strings.HasPrefix(msgName, "json.cloudstate.io/") {
-		return c.Instance.HandleCommand(c, cmd.Name, cmd.Payload)
-	}
-	messageType := proto.MessageType(msgName)
-	message, ok := reflect.New(messageType.Elem()).Interface().(proto.Message)
-	if !ok {
-		return nil, fmt.Errorf("messageType is no proto.Message: %v", messageType)
-	}
-	if err := proto.Unmarshal(cmd.Payload.Value, message); err != nil {
+	message, err := encoding.DefaultRegistry.DecodeMessage(cmd.GetPayload())
+	if err != nil {
 		return nil, err
 	}
 	return c.Instance.HandleCommand(c, cmd.Name, message)
@@ -192,6 +224,9 @@ func (c *CommandContext) changed() (reply *any.Any, err error) {
 }
 
 func (c *CommandContext) cancelled() error {
+	// a cancel handler chooses its write consistency independently of the
+	// command it was registered by.
+	c.writeConsistency = c.Entity.DefaultWriteConsistency
 	return c.cancel(c)
 }
 
@@ -201,6 +236,8 @@ func (c *Context) commandContextFor(cmd *protocol.Command) *CommandContext {
 		cmd:         cmd,
 		CommandID:   CommandID(cmd.Id),
 		sideEffects: make([]*protocol.SideEffect, 0),
+
+		writeConsistency: c.Entity.DefaultWriteConsistency,
 	}
 }
 
@@ -69,7 +69,7 @@ func (c *Context) fail(err error) {
 func (c *Context) initDefault() error {
 	// with a handled state, the CRDT might already be set.
 	if c.crdt != nil {
-		// TODO: the type of c.Instance.Default(c) and c.crdt have to match. should we check that?
+		// The type of the CRDT is validated by the schema of the entity, if it has one.
 		return c.Instance.Set(c, c.crdt)
 	}
 	// with no state given, the entity instance can provide one.
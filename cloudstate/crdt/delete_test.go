@@ -0,0 +1,91 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdt
+
+import (
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+// deletingEntity is a watchingEntity counting the calls of OnDelete.
+type deletingEntity struct {
+	*watchingEntity
+	deleted int
+}
+
+func (e *deletingEntity) OnDelete(*Context) error {
+	e.deleted++
+	return nil
+}
+
+func TestDelete(t *testing.T) {
+	command := func(t *testing.T, id int64, name, key string, streamed bool) *entity.CrdtStreamIn {
+		payload, err := encoding.MarshalAny(&wrappers.StringValue{Value: key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &entity.CrdtStreamIn{Message: &entity.CrdtStreamIn_Command{Command: &protocol.Command{
+			EntityId: "entity-0",
+			Id:       id,
+			Name:     name,
+			Payload:  payload,
+			Streamed: streamed,
+		}}}
+	}
+	e := &deletingEntity{watchingEntity: &watchingEntity{}}
+	server := NewServer()
+	err := server.Register(&Entity{
+		ServiceName: "watching",
+		EntityFunc:  func(EntityID) EntityHandler { return e },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stream{in: []*entity.CrdtStreamIn{
+		{Message: &entity.CrdtStreamIn_Init{Init: &entity.CrdtInit{ServiceName: "watching", EntityId: "entity-0"}}},
+		command(t, 1, "Watch", "a", true),
+		command(t, 2, "Watch", "b", true),
+		{Message: &entity.CrdtStreamIn_Delete{Delete: &entity.CrdtDelete{}}},
+		command(t, 3, "Increment", "a", false),
+		{Message: &entity.CrdtStreamIn_Delete{Delete: &entity.CrdtDelete{}}},
+		{Message: &entity.CrdtStreamIn_Init{Init: &entity.CrdtInit{ServiceName: "watching", EntityId: "entity-0"}}},
+		command(t, 4, "Increment", "a", false),
+	}}
+	if err := server.Handle(s); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(s.sent), 6; got != want {
+		t.Fatalf("len(sent) = %d; want: %d", got, want)
+	}
+	for i, id := range []int64{1, 2} {
+		if m := s.sent[2+i].GetStreamedMessage(); m.GetCommandId() != id || !m.GetEndStream() {
+			t.Fatalf("the streamed command %d should have been ended: %+v", id, s.sent[2+i])
+		}
+	}
+	if f := s.sent[4].GetReply().GetClientAction().GetFailure(); f.GetDescription() != `the entity "entity-0" has been deleted` {
+		t.Fatalf("a command to a deleted entity should be rejected: %+v", s.sent[4])
+	}
+	if f := s.sent[5].GetReply().GetClientAction().GetFailure(); f != nil {
+		t.Fatalf("a command to a new entity should succeed: %+v", f)
+	}
+	if got, want := e.deleted, 1; got != want {
+		t.Fatalf("OnDelete calls = %d; want: %d", got, want)
+	}
+}
@@ -16,6 +16,9 @@
 package crdt
 
 import (
+	"time"
+
+	"github.com/cloudstateio/go-support/cloudstate/entity"
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes/any"
 )
@@ -28,6 +31,22 @@ type Entity struct {
 	ServiceName ServiceName
 	// EntityFunc creates a new entity.
 	EntityFunc func(id EntityID) EntityHandler
+	// CommandTimeout, if set, limits the time a command handler may take.
+	// The context returned by CommandContext.StreamCtx has the deadline of
+	// the command while it is handled. If a handler does not return in time,
+	// a client failure is sent, the entity is restarted and the timeout is
+	// counted by the metrics package. The handler is not stopped though and
+	// keeps running in its goroutine, possibly still mutating the entity
+	// instance and its CRDT. Handlers should therefore return once the
+	// context is done.
+	CommandTimeout time.Duration
+	// DefaultWriteConsistency is the write consistency of state actions
+	// emitted for this entity. Commands and cancel handlers may override it
+	// by CommandContext.WriteConsistency.
+	DefaultWriteConsistency entity.CrdtWriteConsistency
+	// Schema, if set, describes the types of the CRDT of the entity to be
+	// validated.
+	Schema *Schema
 }
 
 // EntityHandler has to be implemented by any type that wants to get
@@ -40,3 +59,10 @@ type EntityHandler interface {
 }
 
 // end::entity-handler[]
+
+// A DeleteHandler is an EntityHandler notified when its entity is deleted,
+// either by a command, a cancel handler or the proxy. OnDelete is called
+// before streamed commands are ended.
+type DeleteHandler interface {
+	OnDelete(ctx *Context) error
+}
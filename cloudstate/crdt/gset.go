@@ -26,18 +26,16 @@ import (
 // A GSet is a very simple CRDT, its merge function is defined by taking
 // the union of the two GSets being merged.
 type GSet struct {
-	value map[uint64]*any.Any
-	added map[uint64]*any.Any
-	*anyHasher
+	value map[anyKey]*any.Any
+	added map[anyKey]*any.Any
 }
 
 var _ CRDT = (*GSet)(nil)
 
 func NewGSet() *GSet {
 	return &GSet{
-		value:     make(map[uint64]*any.Any),
-		added:     make(map[uint64]*any.Any),
-		anyHasher: &anyHasher{},
+		value: make(map[anyKey]*any.Any),
+		added: make(map[anyKey]*any.Any),
 	}
 }
 
@@ -46,7 +44,7 @@ func (s GSet) Size() int {
 }
 
 func (s *GSet) Add(a *any.Any) {
-	h := s.hashAny(a)
+	h := keyOf(a)
 	if _, exists := s.value[h]; exists {
 		return
 	}
@@ -89,7 +87,7 @@ func (s GSet) Delta() *entity.CrdtDelta {
 }
 
 func (s *GSet) resetDelta() {
-	s.added = make(map[uint64]*any.Any)
+	s.added = make(map[anyKey]*any.Any)
 }
 
 func (s *GSet) applyDelta(delta *entity.CrdtDelta) error {
@@ -98,7 +96,7 @@ func (s *GSet) applyDelta(delta *entity.CrdtDelta) error {
 		return fmt.Errorf("unable to apply state %+v to GSet", delta)
 	}
 	for _, v := range d.GetAdded() {
-		s.value[s.hashAny(v)] = v
+		s.value[keyOf(v)] = v
 	}
 	return nil
 }
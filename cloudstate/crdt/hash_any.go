@@ -16,18 +16,71 @@
 package crdt
 
 import (
-	"hash/maphash"
+	"bytes"
+	"encoding/json"
+	"strings"
 
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/any"
 )
 
-type anyHasher struct {
-	h maphash.Hash
+// anyKey identifies an element of a set, or a key of a map, by its type URL
+// and canonical value. Used as a map key, elements are bucketed by the hash
+// of their anyKey and compared for exact equality within a bucket, so that
+// distinct elements never collide.
+type anyKey string
+
+// keyOf returns the anyKey of a.
+func keyOf(a *any.Any) anyKey {
+	return anyKey(a.GetTypeUrl() + "\x00" + string(canonical(a)))
 }
 
-func (h *anyHasher) hashAny(a *any.Any) uint64 {
-	h.h.Reset()
-	_, _ = h.h.WriteString(a.GetTypeUrl()) // does never err
-	_, _ = h.h.Write(a.GetValue())         // does never err
-	return h.h.Sum64()
+// canonical returns the value of a encoded canonically, so that equal
+// values encoded differently are equal. Primitives are re-encoded, JSON
+// values are compacted with their object keys sorted and registered protobuf
+// messages are re-encoded deterministically. Other values are returned as
+// they are.
+func canonical(a *any.Any) []byte {
+	typeURL := a.GetTypeUrl()
+	switch {
+	case strings.HasPrefix(typeURL, encoding.PrimitiveTypeURLPrefix):
+		v, err := encoding.UnmarshalPrimitive(a)
+		if err != nil {
+			return a.GetValue()
+		}
+		p, err := encoding.MarshalPrimitive(v)
+		if err != nil {
+			return a.GetValue()
+		}
+		return p.GetValue()
+	case strings.HasPrefix(typeURL, encoding.JSONTypeURLPrefix):
+		var raw json.RawMessage
+		if err := encoding.UnmarshalJSON(a, &raw); err != nil {
+			return a.GetValue()
+		}
+		d := json.NewDecoder(bytes.NewReader(raw))
+		d.UseNumber()
+		var v interface{}
+		if err := d.Decode(&v); err != nil {
+			return a.GetValue()
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return a.GetValue()
+		}
+		return b
+	}
+	var msg ptypes.DynamicAny
+	if err := ptypes.UnmarshalAny(a, &msg); err != nil {
+		// the message type is not registered.
+		return a.GetValue()
+	}
+	buffer := proto.NewBuffer(nil)
+	buffer.SetDeterministic(true)
+	if err := buffer.Marshal(msg.Message); err != nil {
+		return a.GetValue()
+	}
+	return buffer.Bytes()
 }
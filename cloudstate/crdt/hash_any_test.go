@@ -0,0 +1,143 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdt
+
+import (
+	"fmt"
+	"hash/maphash"
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func TestKeyOf(t *testing.T) {
+	jsonOf := func(s string) *any.Any {
+		buffer := proto.NewBuffer(nil)
+		_ = buffer.EncodeVarint(1<<3 | proto.WireBytes)
+		_ = buffer.EncodeRawBytes([]byte(s))
+		return &any.Any{TypeUrl: encoding.JSONTypeURLPrefix + "/t", Value: buffer.Bytes()}
+	}
+	// anyOf encodes an any.Any in an any.Any with its fields in the order
+	// given by reverse.
+	anyOf := func(reverse bool) *any.Any {
+		buffer := proto.NewBuffer(nil)
+		typeURL := func() {
+			_ = buffer.EncodeVarint(1<<3 | proto.WireBytes)
+			_ = buffer.EncodeStringBytes("t")
+		}
+		value := func() {
+			_ = buffer.EncodeVarint(2<<3 | proto.WireBytes)
+			_ = buffer.EncodeRawBytes([]byte("v"))
+		}
+		if reverse {
+			value()
+			typeURL()
+		} else {
+			typeURL()
+			value()
+		}
+		return &any.Any{TypeUrl: "type.googleapis.com/google.protobuf.Any", Value: buffer.Bytes()}
+	}
+
+	for _, tc := range []struct {
+		name string
+		a, b *any.Any
+		want bool
+	}{
+		{"equal primitives", encoding.String("a"), encoding.String("a"), true},
+		{"distinct primitives", encoding.String("a"), encoding.String("b"), false},
+		{"empty strings encoded differently", encoding.String(""), &any.Any{
+			TypeUrl: encoding.PrimitiveTypeURLPrefixString,
+			Value:   []byte{1<<3 | proto.WireBytes, 0},
+		}, true},
+		{"equal bytes of distinct types", encoding.Int32(1), encoding.Int64(1), false},
+		{"JSON objects with keys reordered", jsonOf(`{"a":1,"b":[true]}`), jsonOf(`{ "b": [true], "a": 1 }`), true},
+		{"distinct JSON objects", jsonOf(`{"a":1}`), jsonOf(`{"a":2}`), false},
+		{"messages with fields reordered", anyOf(false), anyOf(true), true},
+		{"unregistered messages", &any.Any{TypeUrl: "type.googleapis.com/x.Y", Value: []byte{1}}, &any.Any{TypeUrl: "type.googleapis.com/x.Y", Value: []byte{1}}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := keyOf(tc.a) == keyOf(tc.b); got != tc.want {
+				t.Fatalf("keyOf(%v) == keyOf(%v): %v; want: %v", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+
+	t.Run("an ORSet has semantically equal elements once", func(t *testing.T) {
+		s := NewORSet()
+		s.Add(jsonOf(`{"a":1,"b":2}`))
+		s.Add(jsonOf(`{"b":2,"a":1}`))
+		if s.Size() != 1 {
+			t.Fatalf("s.Size(): %v; want: %v", s.Size(), 1)
+		}
+	})
+}
+
+func BenchmarkKeyOf(b *testing.B) {
+	msg, err := encoding.MarshalAny(&wrappers.StringValue{Value: "value"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	json, err := encoding.JSON(map[string]interface{}{"a": 1, "b": "value"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bc := range []struct {
+		name string
+		a    *any.Any
+	}{
+		{"primitive", encoding.String("value")},
+		{"json", json},
+		{"proto", msg},
+		{"unregistered", &any.Any{TypeUrl: "type.googleapis.com/x.Y", Value: []byte("value")}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				keyOf(bc.a)
+			}
+		})
+	} // the 64-bit hash formerly used as the key, for comparison.
+	b.Run("maphash", func(b *testing.B) {
+		b.ReportAllocs()
+		var h maphash.Hash
+		for i := 0; i < b.N; i++ {
+			h.Reset()
+			_, _ = h.WriteString(msg.GetTypeUrl())
+			_, _ = h.Write(msg.GetValue())
+			h.Sum64()
+		}
+	})
+}
+
+func BenchmarkORSetAdd(b *testing.B) {
+	for _, size := range []int{100, 10000} {
+		elements := make([]*any.Any, size)
+		for i := range elements {
+			elements[i] = encoding.String(fmt.Sprintf("element-%d", i))
+		}
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			b.ReportAllocs()
+			s := NewORSet()
+			for i := 0; i < b.N; i++ {
+				s.Add(elements[i%size])
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdt
+
+import (
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// An LWWMap is an ORMap of LWWRegisters, mapping keys to a value each.
+type LWWMap struct {
+	m *ORMap
+}
+
+var _ CRDT = (*LWWMap)(nil)
+
+func NewLWWMap() *LWWMap {
+	return &LWWMap{m: NewORMap()}
+}
+
+// LWWMapOf returns an LWWMap with the entries of m, like for an ORMap an
+// entity is set to by a delta. Values of m that are not LWWRegisters are
+// replaced when a value is put to their key.
+func LWWMapOf(m *ORMap) *LWWMap {
+	return &LWWMap{m: m}
+}
+
+// Put sets the value of key.
+func (m *LWWMap) Put(key, value *any.Any) {
+	m.PutWithClock(key, value, Default, 0)
+}
+
+// PutWithClock sets the value of key using the clock, as described by
+// LWWRegister.SetWithClock.
+func (m *LWWMap) PutWithClock(key, value *any.Any, c Clock, customClockValue int64) {
+	if r, ok := m.m.Get(key).(*LWWRegister); ok {
+		r.SetWithClock(value, c, customClockValue)
+		return
+	}
+	m.m.Set(key, NewLWWRegisterWithClock(value, c, customClockValue))
+}
+
+// Get returns the value of key or nil if there is none.
+func (m *LWWMap) Get(key *any.Any) *any.Any {
+	if r, ok := m.m.Get(key).(*LWWRegister); ok {
+		return r.Value()
+	}
+	return nil
+}
+
+// Remove removes key and its value.
+func (m *LWWMap) Remove(key *any.Any) {
+	m.m.Delete(key)
+}
+
+func (m *LWWMap) HasKey(key *any.Any) bool {
+	return m.m.HasKey(key)
+}
+
+func (m *LWWMap) Keys() []*any.Any {
+	return m.m.Keys()
+}
+
+func (m *LWWMap) Size() int {
+	return m.m.Size()
+}
+
+func (m *LWWMap) Clear() {
+	m.m.Clear()
+}
+
+func (m *LWWMap) HasDelta() bool {
+	return m.m.HasDelta()
+}
+
+func (m *LWWMap) Delta() *entity.CrdtDelta {
+	return m.m.Delta()
+}
+
+func (m *LWWMap) resetDelta() {
+	m.m.resetDelta()
+}
+
+func (m *LWWMap) applyDelta(delta *entity.CrdtDelta) error {
+	return m.m.applyDelta(delta)
+}
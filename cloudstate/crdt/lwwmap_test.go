@@ -0,0 +1,74 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdt
+
+import (
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestLWWMap(t *testing.T) {
+	a := encoding.String("a")
+
+	t.Run("should put and remove values", func(t *testing.T) {
+		m := NewLWWMap()
+		m.Put(a, encoding.Int64(1))
+		m.Put(a, encoding.Int64(2))
+		if got := encoding.DecodeInt64(m.Get(a)); got != 2 {
+			t.Fatalf("m.Get(a): %v; want: %v", got, 2)
+		}
+		if m.Size() != 1 {
+			t.Fatalf("m.Size(): %v; want: %v", m.Size(), 1)
+		}
+		m.Remove(a)
+		if m.Get(a) != nil || m.HasKey(a) {
+			t.Fatal("a should have been removed")
+		}
+	})
+	t.Run("should replicate by its deltas", func(t *testing.T) {
+		m := NewLWWMap()
+		m.PutWithClock(a, encoding.Int64(1), Custom, 4)
+		replica := LWWMapOf(NewORMap())
+		if err := replica.applyDelta(encDecDelta(m.Delta())); err != nil {
+			t.Fatal(err)
+		}
+		m.resetDelta()
+		m.Put(a, encoding.Int64(2))
+		if !m.HasDelta() {
+			t.Fatal("an updated value should have a delta")
+		}
+		if err := replica.applyDelta(encDecDelta(m.Delta())); err != nil {
+			t.Fatal(err)
+		}
+		if !proto.Equal(replica.Get(a), encoding.Int64(2)) {
+			t.Fatalf("replica.Get(a): %v; want: %v", replica.Get(a), 2)
+		}
+	})
+	t.Run("should replace values that are not registers", func(t *testing.T) {
+		o := NewORMap()
+		o.Set(a, NewGCounter())
+		m := LWWMapOf(o)
+		if m.Get(a) != nil {
+			t.Fatal("a counter should have no value")
+		}
+		m.Put(a, encoding.Int64(1))
+		if got := encoding.DecodeInt64(m.Get(a)); got != 1 {
+			t.Fatalf("m.Get(a): %v; want: %v", got, 1)
+		}
+	})
+}
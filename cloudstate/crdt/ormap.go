@@ -28,9 +28,8 @@ import (
 // modified concurrently on two different nodes, the values from the two nodes
 // are merged together.
 type ORMap struct {
-	value map[uint64]*ORMapEntry
+	value map[anyKey]*ORMapEntry
 	delta orMapDelta
-	*anyHasher
 }
 
 type ORMapEntry struct {
@@ -41,8 +40,8 @@ type ORMapEntry struct {
 var _ CRDT = (*ORMap)(nil)
 
 type orMapDelta struct {
-	added   map[uint64]*any.Any
-	removed map[uint64]*any.Any
+	added   map[anyKey]*any.Any
+	removed map[anyKey]*any.Any
 	cleared bool
 }
 
@@ -58,18 +57,17 @@ func (m *ORMap) Entries() []*ORMapEntry {
 
 func NewORMap() *ORMap {
 	return &ORMap{
-		value: make(map[uint64]*ORMapEntry),
+		value: make(map[anyKey]*ORMapEntry),
 		delta: orMapDelta{
-			added:   make(map[uint64]*any.Any),
-			removed: make(map[uint64]*any.Any),
+			added:   make(map[anyKey]*any.Any),
+			removed: make(map[anyKey]*any.Any),
 			cleared: false,
 		},
-		anyHasher: &anyHasher{},
 	}
 }
 
 func (m *ORMap) HasKey(x *any.Any) (hasKey bool) {
-	_, hasKey = m.value[m.hashAny(x)]
+	_, hasKey = m.value[keyOf(x)]
 	return
 }
 
@@ -88,14 +86,14 @@ func (m *ORMap) Keys() []*any.Any {
 }
 
 func (m *ORMap) Get(key *any.Any) CRDT {
-	if s, ok := m.value[m.hashAny(key)]; ok {
+	if s, ok := m.value[keyOf(key)]; ok {
 		return s.Value
 	}
 	return nil
 }
 
 func (m *ORMap) Set(key *any.Any, value CRDT) {
-	k := m.hashAny(key)
+	k := keyOf(key)
 	// from ref. impl: Setting an existing Key to a new value
 	// can have unintended effects, as the old value may end
 	// up being merged with the new.
@@ -112,7 +110,7 @@ func (m *ORMap) Set(key *any.Any, value CRDT) {
 }
 
 func (m *ORMap) Delete(key *any.Any) {
-	k := m.hashAny(key)
+	k := keyOf(key)
 	if _, has := m.value[k]; !has {
 		return
 	}
@@ -132,13 +130,13 @@ func (m *ORMap) Clear() {
 	if len(m.value) == 0 {
 		return
 	}
-	m.value = make(map[uint64]*ORMapEntry)
+	m.value = make(map[anyKey]*ORMapEntry)
 	m.delta.clear()
 }
 
 func (d *orMapDelta) clear() {
-	d.added = make(map[uint64]*any.Any)
-	d.removed = make(map[uint64]*any.Any)
+	d.added = make(map[anyKey]*any.Any)
+	d.removed = make(map[anyKey]*any.Any)
 	d.cleared = true
 }
 
@@ -162,7 +160,7 @@ func (m *ORMap) Delta() *entity.CrdtDelta {
 			Key:   v.Key,
 			Delta: v.Value.Delta(),
 		}
-		if _, has := m.delta.added[m.hashAny(v.Key)]; has {
+		if _, has := m.delta.added[keyOf(v.Key)]; has {
 			added = append(added, delta)
 		} else if v.Value.HasDelta() {
 			updated = append(updated, delta)
@@ -192,10 +190,10 @@ func (m *ORMap) applyDelta(delta *entity.CrdtDelta) error {
 		return fmt.Errorf("unable to apply delta %v to the ORMap", delta)
 	}
 	if d.GetCleared() {
-		m.value = make(map[uint64]*ORMapEntry)
+		m.value = make(map[anyKey]*ORMapEntry)
 	}
 	for _, r := range d.GetRemoved() {
-		delete(m.value, m.hashAny(r))
+		delete(m.value, keyOf(r))
 	}
 	for _, a := range d.Added {
 		var err error
@@ -208,13 +206,13 @@ func (m *ORMap) applyDelta(delta *entity.CrdtDelta) error {
 		if err := value.applyDelta(a.GetDelta()); err != nil {
 			return err
 		}
-		m.value[m.hashAny(a.GetKey())] = &ORMapEntry{
+		m.value[keyOf(a.GetKey())] = &ORMapEntry{
 			Key:   a.GetKey(),
 			Value: value,
 		}
 	}
 	for _, u := range d.Updated {
-		if v, has := m.value[m.hashAny(u.GetKey())]; has {
+		if v, has := m.value[keyOf(u.GetKey())]; has {
 			if err := v.Value.applyDelta(u.GetDelta()); err != nil {
 				return err
 			}
@@ -228,6 +226,6 @@ func (m *ORMap) resetDelta() {
 		v.Value.resetDelta()
 	}
 	m.delta.cleared = false // TODO: what's the thing with cleared to be different to orMapDelta.clear()?
-	m.delta.added = make(map[uint64]*any.Any)
-	m.delta.removed = make(map[uint64]*any.Any)
+	m.delta.added = make(map[anyKey]*any.Any)
+	m.delta.removed = make(map[anyKey]*any.Any)
 }
@@ -22,7 +22,7 @@ import (
 )
 
 func (m *ORMap) Flag(key *any.Any) (*Flag, error) {
-	if v, has := m.value[m.hashAny(key)]; has {
+	if v, has := m.value[keyOf(key)]; has {
 		if flag, ok := v.Value.(*Flag); ok {
 			return flag, nil
 		}
@@ -32,7 +32,7 @@ func (m *ORMap) Flag(key *any.Any) (*Flag, error) {
 }
 
 func (m *ORMap) GCounter(key *any.Any) (*GCounter, error) {
-	if v, has := m.value[m.hashAny(key)]; has {
+	if v, has := m.value[keyOf(key)]; has {
 		if counter, ok := v.Value.(*GCounter); ok {
 			return counter, nil
 		}
@@ -42,7 +42,7 @@ func (m *ORMap) GCounter(key *any.Any) (*GCounter, error) {
 }
 
 func (m *ORMap) GSet(key *any.Any) (*GSet, error) {
-	if v, has := m.value[m.hashAny(key)]; has {
+	if v, has := m.value[keyOf(key)]; has {
 		if set, ok := v.Value.(*GSet); ok {
 			return set, nil
 		}
@@ -52,7 +52,7 @@ func (m *ORMap) GSet(key *any.Any) (*GSet, error) {
 }
 
 func (m *ORMap) LWWRegister(key *any.Any) (*LWWRegister, error) {
-	if v, has := m.value[m.hashAny(key)]; has {
+	if v, has := m.value[keyOf(key)]; has {
 		if r, ok := v.Value.(*LWWRegister); ok {
 			return r, nil
 		}
@@ -62,7 +62,7 @@ func (m *ORMap) LWWRegister(key *any.Any) (*LWWRegister, error) {
 }
 
 func (m *ORMap) ORMap(key *any.Any) (*ORMap, error) {
-	if v, has := m.value[m.hashAny(key)]; has {
+	if v, has := m.value[keyOf(key)]; has {
 		if m, ok := v.Value.(*ORMap); ok {
 			return m, nil
 		}
@@ -72,7 +72,7 @@ func (m *ORMap) ORMap(key *any.Any) (*ORMap, error) {
 }
 
 func (m *ORMap) ORSet(key *any.Any) (*ORSet, error) {
-	if v, has := m.value[m.hashAny(key)]; has {
+	if v, has := m.value[keyOf(key)]; has {
 		if set, ok := v.Value.(*ORSet); ok {
 			return set, nil
 		}
@@ -82,7 +82,7 @@ func (m *ORMap) ORSet(key *any.Any) (*ORSet, error) {
 }
 
 func (m *ORMap) PNCounter(key *any.Any) (*PNCounter, error) {
-	if v, has := m.value[m.hashAny(key)]; has {
+	if v, has := m.value[keyOf(key)]; has {
 		if c, ok := v.Value.(*PNCounter); ok {
 			return c, nil
 		}
@@ -92,7 +92,7 @@ func (m *ORMap) PNCounter(key *any.Any) (*PNCounter, error) {
 }
 
 func (m *ORMap) Vote(key *any.Any) (*Vote, error) {
-	if v, has := m.value[m.hashAny(key)]; has {
+	if v, has := m.value[keyOf(key)]; has {
 		if c, ok := v.Value.(*Vote); ok {
 			return c, nil
 		}
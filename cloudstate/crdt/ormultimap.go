@@ -0,0 +1,119 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdt
+
+import (
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// An ORMultiMap is an ORMap of ORSets, mapping keys to sets of values.
+// Entries are created when a value is put to a key and deleted when the last
+// value of a key is removed.
+type ORMultiMap struct {
+	m *ORMap
+}
+
+var _ CRDT = (*ORMultiMap)(nil)
+
+func NewORMultiMap() *ORMultiMap {
+	return &ORMultiMap{m: NewORMap()}
+}
+
+// ORMultiMapOf returns an ORMultiMap with the entries of m, like for an
+// ORMap an entity is set to by a delta. Values of m that are not ORSets are
+// replaced when a value is put to their key.
+func ORMultiMapOf(m *ORMap) *ORMultiMap {
+	return &ORMultiMap{m: m}
+}
+
+// Put adds value to the values of key.
+func (m *ORMultiMap) Put(key, value *any.Any) {
+	s, ok := m.m.Get(key).(*ORSet)
+	if !ok {
+		s = NewORSet()
+		s.Add(value)
+		m.m.Set(key, s)
+		return
+	}
+	s.Add(value)
+}
+
+// Remove removes value from the values of key.
+func (m *ORMultiMap) Remove(key, value *any.Any) {
+	s, ok := m.m.Get(key).(*ORSet)
+	if !ok {
+		return
+	}
+	if s.Size() == 1 && s.Contains(value) {
+		m.m.Delete(key)
+		return
+	}
+	s.Remove(value)
+}
+
+// RemoveAll removes all values of key.
+func (m *ORMultiMap) RemoveAll(key *any.Any) {
+	m.m.Delete(key)
+}
+
+// Get returns the values of key.
+func (m *ORMultiMap) Get(key *any.Any) []*any.Any {
+	if s, ok := m.m.Get(key).(*ORSet); ok {
+		return s.Value()
+	}
+	return nil
+}
+
+// Contains returns true if value is one of the values of key.
+func (m *ORMultiMap) Contains(key, value *any.Any) bool {
+	if s, ok := m.m.Get(key).(*ORSet); ok {
+		return s.Contains(value)
+	}
+	return false
+}
+
+func (m *ORMultiMap) HasKey(key *any.Any) bool {
+	return m.m.HasKey(key)
+}
+
+func (m *ORMultiMap) Keys() []*any.Any {
+	return m.m.Keys()
+}
+
+func (m *ORMultiMap) Size() int {
+	return m.m.Size()
+}
+
+func (m *ORMultiMap) Clear() {
+	m.m.Clear()
+}
+
+func (m *ORMultiMap) HasDelta() bool {
+	return m.m.HasDelta()
+}
+
+func (m *ORMultiMap) Delta() *entity.CrdtDelta {
+	return m.m.Delta()
+}
+
+func (m *ORMultiMap) resetDelta() {
+	m.m.resetDelta()
+}
+
+func (m *ORMultiMap) applyDelta(delta *entity.CrdtDelta) error {
+	return m.m.applyDelta(delta)
+}
@@ -0,0 +1,82 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdt
+
+import (
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+)
+
+func TestORMultiMap(t *testing.T) {
+	a, b := encoding.String("a"), encoding.String("b")
+	one, two := encoding.Int64(1), encoding.Int64(2)
+
+	t.Run("should put values to keys", func(t *testing.T) {
+		m := NewORMultiMap()
+		m.Put(a, one)
+		m.Put(a, two)
+		m.Put(a, two)
+		m.Put(b, one)
+		if got := len(m.Get(a)); got != 2 {
+			t.Fatalf("len(m.Get(a)): %v; want: %v", got, 2)
+		}
+		if !m.Contains(b, one) || m.Contains(b, two) {
+			t.Fatalf("m.Get(b): %v; want: [1]", m.Get(b))
+		}
+		if m.Get(encoding.String("c")) != nil {
+			t.Fatal("a missing key should have no values")
+		}
+	})
+	t.Run("should delete a key with its last value removed", func(t *testing.T) {
+		m := NewORMultiMap()
+		m.Put(a, one)
+		m.Put(a, two)
+		m.Put(b, one)
+		m.resetDelta()
+		m.Remove(a, one)
+		if !m.HasKey(a) {
+			t.Fatal("a should have a value left")
+		}
+		m.Remove(a, two)
+		if m.HasKey(a) {
+			t.Fatal("a should have been deleted")
+		}
+		if got := len(encDecDelta(m.Delta()).GetOrmap().GetRemoved()); got != 1 {
+			t.Fatalf("len(removed): %v; want: %v", got, 1)
+		}
+		m.Remove(b, two)
+		if !m.HasKey(b) {
+			t.Fatal("removing a value not present should keep the key")
+		}
+	})
+	t.Run("should replicate by its deltas", func(t *testing.T) {
+		m := NewORMultiMap()
+		m.Put(a, one)
+		replica := ORMultiMapOf(NewORMap())
+		if err := replica.applyDelta(encDecDelta(m.Delta())); err != nil {
+			t.Fatal(err)
+		}
+		m.resetDelta()
+		m.Put(a, two)
+		if err := replica.applyDelta(encDecDelta(m.Delta())); err != nil {
+			t.Fatal(err)
+		}
+		if !replica.Contains(a, one) || !replica.Contains(a, two) {
+			t.Fatalf("replica.Get(a): %v; want: [1 2]", replica.Get(a))
+		}
+	})
+}
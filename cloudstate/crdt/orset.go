@@ -29,22 +29,20 @@ import (
 // to the removal set, so as long as there haven’t been any new additions that
 // the node hasn’t seen when it removed the element, the element will be removed.
 type ORSet struct {
-	value   map[uint64]*any.Any
-	added   map[uint64]*any.Any
-	removed map[uint64]*any.Any
+	value   map[anyKey]*any.Any
+	added   map[anyKey]*any.Any
+	removed map[anyKey]*any.Any
 	cleared bool
-	*anyHasher
 }
 
 var _ CRDT = (*ORSet)(nil)
 
 func NewORSet() *ORSet {
 	return &ORSet{
-		value:     make(map[uint64]*any.Any),
-		added:     make(map[uint64]*any.Any),
-		removed:   make(map[uint64]*any.Any),
-		cleared:   false,
-		anyHasher: &anyHasher{},
+		value:   make(map[anyKey]*any.Any),
+		added:   make(map[anyKey]*any.Any),
+		removed: make(map[anyKey]*any.Any),
+		cleared: false,
 	}
 }
 
@@ -52,8 +50,14 @@ func (s *ORSet) Size() int {
 	return len(s.value)
 }
 
+// Contains returns true if a is an element of the set.
+func (s *ORSet) Contains(a *any.Any) bool {
+	_, ok := s.value[keyOf(a)]
+	return ok
+}
+
 func (s *ORSet) Add(a *any.Any) {
-	h := s.hashAny(a)
+	h := keyOf(a)
 	if _, ok := s.value[h]; ok {
 		return
 	}
@@ -66,7 +70,7 @@ func (s *ORSet) Add(a *any.Any) {
 }
 
 func (s *ORSet) Remove(a *any.Any) {
-	h := s.hashAny(a)
+	h := keyOf(a)
 	if _, ok := s.value[h]; !ok {
 		return
 	}
@@ -83,9 +87,9 @@ func (s *ORSet) Remove(a *any.Any) {
 }
 
 func (s *ORSet) Clear() {
-	s.value = make(map[uint64]*any.Any)
-	s.added = make(map[uint64]*any.Any)
-	s.removed = make(map[uint64]*any.Any)
+	s.value = make(map[anyKey]*any.Any)
+	s.added = make(map[anyKey]*any.Any)
+	s.removed = make(map[anyKey]*any.Any)
 	s.cleared = true
 }
 
@@ -137,8 +141,8 @@ func (s *ORSet) HasDelta() bool {
 
 func (s *ORSet) resetDelta() {
 	s.cleared = false
-	s.added = make(map[uint64]*any.Any)
-	s.removed = make(map[uint64]*any.Any)
+	s.added = make(map[anyKey]*any.Any)
+	s.removed = make(map[anyKey]*any.Any)
 }
 
 func (s *ORSet) applyDelta(delta *entity.CrdtDelta) error {
@@ -147,13 +151,13 @@ func (s *ORSet) applyDelta(delta *entity.CrdtDelta) error {
 		return fmt.Errorf("unable to delta %v to ORSet", delta)
 	}
 	if d.GetCleared() {
-		s.value = make(map[uint64]*any.Any)
+		s.value = make(map[anyKey]*any.Any)
 	}
 	for _, r := range d.GetRemoved() {
-		delete(s.value, s.hashAny(r))
+		delete(s.value, keyOf(r))
 	}
 	for _, a := range d.GetAdded() {
-		h := s.hashAny(a)
+		h := keyOf(a)
 		if _, ok := s.value[h]; !ok {
 			s.value[h] = a
 		}
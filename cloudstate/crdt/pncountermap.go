@@ -0,0 +1,104 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdt
+
+import (
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// A PNCounterMap is an ORMap of PNCounters, mapping keys to a counter each.
+// A counter is created when its key is first incremented or decremented.
+type PNCounterMap struct {
+	m *ORMap
+}
+
+var _ CRDT = (*PNCounterMap)(nil)
+
+func NewPNCounterMap() *PNCounterMap {
+	return &PNCounterMap{m: NewORMap()}
+}
+
+// PNCounterMapOf returns a PNCounterMap with the entries of m, like for an
+// ORMap an entity is set to by a delta. Values of m that are not PNCounters
+// are replaced when their key is incremented or decremented.
+func PNCounterMapOf(m *ORMap) *PNCounterMap {
+	return &PNCounterMap{m: m}
+}
+
+// Increment increments the counter of key by n.
+func (m *PNCounterMap) Increment(key *any.Any, n int64) {
+	m.counter(key).Increment(n)
+}
+
+// Decrement decrements the counter of key by n.
+func (m *PNCounterMap) Decrement(key *any.Any, n int64) {
+	m.counter(key).Decrement(n)
+}
+
+func (m *PNCounterMap) counter(key *any.Any) *PNCounter {
+	c, ok := m.m.Get(key).(*PNCounter)
+	if !ok {
+		c = NewPNCounter()
+		m.m.Set(key, c)
+	}
+	return c
+}
+
+// Get returns the value of the counter of key, zero if there is none.
+func (m *PNCounterMap) Get(key *any.Any) int64 {
+	if c, ok := m.m.Get(key).(*PNCounter); ok {
+		return c.Value()
+	}
+	return 0
+}
+
+// Remove removes key and its counter.
+func (m *PNCounterMap) Remove(key *any.Any) {
+	m.m.Delete(key)
+}
+
+func (m *PNCounterMap) HasKey(key *any.Any) bool {
+	return m.m.HasKey(key)
+}
+
+func (m *PNCounterMap) Keys() []*any.Any {
+	return m.m.Keys()
+}
+
+func (m *PNCounterMap) Size() int {
+	return m.m.Size()
+}
+
+func (m *PNCounterMap) Clear() {
+	m.m.Clear()
+}
+
+func (m *PNCounterMap) HasDelta() bool {
+	return m.m.HasDelta()
+}
+
+func (m *PNCounterMap) Delta() *entity.CrdtDelta {
+	return m.m.Delta()
+}
+
+func (m *PNCounterMap) resetDelta() {
+	m.m.resetDelta()
+}
+
+func (m *PNCounterMap) applyDelta(delta *entity.CrdtDelta) error {
+	return m.m.applyDelta(delta)
+}
@@ -0,0 +1,65 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdt
+
+import (
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+)
+
+func TestPNCounterMap(t *testing.T) {
+	a, b := encoding.String("a"), encoding.String("b")
+
+	t.Run("should count by keys", func(t *testing.T) {
+		m := NewPNCounterMap()
+		m.Increment(a, 3)
+		m.Decrement(a, 1)
+		m.Decrement(b, 2)
+		if got := m.Get(a); got != 2 {
+			t.Fatalf("m.Get(a): %v; want: %v", got, 2)
+		}
+		if got := m.Get(b); got != -2 {
+			t.Fatalf("m.Get(b): %v; want: %v", got, -2)
+		}
+		if got := m.Get(encoding.String("c")); got != 0 {
+			t.Fatalf("m.Get(c): %v; want: %v", got, 0)
+		}
+		m.Remove(b)
+		if m.HasKey(b) || m.Size() != 1 {
+			t.Fatal("b should have been removed")
+		}
+	})
+	t.Run("should replicate by its deltas", func(t *testing.T) {
+		m := NewPNCounterMap()
+		m.Increment(a, 3)
+		replica := PNCounterMapOf(NewORMap())
+		if err := replica.applyDelta(encDecDelta(m.Delta())); err != nil {
+			t.Fatal(err)
+		}
+		m.resetDelta()
+		m.Increment(a, 2)
+		if got := encDecDelta(m.Delta()).GetOrmap().GetUpdated()[0].GetDelta().GetPncounter().GetChange(); got != 2 {
+			t.Fatalf("change: %v; want: %v", got, 2)
+		}
+		if err := replica.applyDelta(encDecDelta(m.Delta())); err != nil {
+			t.Fatal(err)
+		}
+		if got := replica.Get(a); got != 5 {
+			t.Fatalf("replica.Get(a): %v; want: %v", got, 5)
+		}
+	})
+}
@@ -0,0 +1,232 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdt
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// RenderJSON renders a CRDT, including nested ones of an ORMap, as an
+// indented JSON document for debugging and to be compared in tests.
+//
+// Each CRDT is rendered as an object with its type, its value and, if it has
+// one, its pending delta. Values of type any.Any are decoded as primitives,
+// as JSON or as registered protobuf messages. Others are rendered by their
+// type URL and bytes. Elements of sets and maps are sorted by their rendered
+// JSON, so that the document is stable.
+func RenderJSON(c CRDT) ([]byte, error) {
+	r, err := render(c)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(r, "", "  ")
+}
+
+func render(c CRDT) (map[string]interface{}, error) {
+	var value, delta interface{}
+	var err error
+	switch c := c.(type) {
+	case nil:
+		return nil, nil
+	case *GCounter:
+		value = c.value
+		delta = map[string]interface{}{"increment": c.delta}
+	case *PNCounter:
+		value = c.value
+		delta = map[string]interface{}{"change": c.delta}
+	case *Flag:
+		value = c.value
+		delta = map[string]interface{}{"value": c.delta}
+	case *Vote:
+		value = map[string]interface{}{
+			"selfVote": c.selfVote,
+			"voters":   c.voters,
+			"votesFor": c.votesFor,
+		}
+		delta = map[string]interface{}{"selfVote": c.selfVote}
+	case *LWWRegister:
+		if value, err = renderRegister(c.value, c.clock, c.customClockValue); err != nil {
+			return nil, err
+		}
+		if delta, err = renderRegister(c.delta.value, c.delta.clock, c.delta.customClockValue); err != nil {
+			return nil, err
+		}
+	case *GSet:
+		if value, err = renderAnys(c.Value()); err != nil {
+			return nil, err
+		}
+		added, err := renderAnys(c.Added())
+		if err != nil {
+			return nil, err
+		}
+		delta = map[string]interface{}{"added": added}
+	case *ORSet:
+		if value, err = renderAnys(c.Value()); err != nil {
+			return nil, err
+		}
+		if delta, err = renderSetDelta(c.Added(), c.Removed(), c.cleared); err != nil {
+			return nil, err
+		}
+	case *ORMap:
+		if value, err = renderEntries(c.Entries()); err != nil {
+			return nil, err
+		}
+		if delta, err = renderSetDelta(values(c.delta.added), values(c.delta.removed), c.delta.cleared); err != nil {
+			return nil, err
+		}
+	case *ORMultiMap:
+		return renderAs("ORMultiMap", c.m)
+	case *LWWMap:
+		return renderAs("LWWMap", c.m)
+	case *PNCounterMap:
+		return renderAs("PNCounterMap", c.m)
+	default:
+		return nil, fmt.Errorf("unable to render CRDT of type: %T", c)
+	}
+	r := map[string]interface{}{
+		"type":  strings.TrimPrefix(fmt.Sprintf("%T", c), "*crdt."),
+		"value": value,
+	}
+	if c.HasDelta() {
+		r["delta"] = delta
+	}
+	return r, nil
+}
+
+// renderAs renders m with the type of the CRDT composed from it.
+func renderAs(typ string, m *ORMap) (map[string]interface{}, error) {
+	r, err := render(m)
+	if err != nil {
+		return nil, err
+	}
+	r["type"] = typ
+	return r, nil
+}
+
+func renderRegister(x *any.Any, clock Clock, customClockValue int64) (map[string]interface{}, error) {
+	value, err := renderAny(x)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"value":            value,
+		"clock":            clock.toCrdtClock().String(),
+		"customClockValue": customClockValue,
+	}, nil
+}
+
+func renderSetDelta(added, removed []*any.Any, cleared bool) (map[string]interface{}, error) {
+	a, err := renderAnys(added)
+	if err != nil {
+		return nil, err
+	}
+	r, err := renderAnys(removed)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"added": a, "removed": r, "cleared": cleared}, nil
+}
+
+func renderEntries(entries []*ORMapEntry) ([]interface{}, error) {
+	rendered := make([]interface{}, 0, len(entries))
+	for _, e := range entries {
+		key, err := renderAny(e.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := render(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, map[string]interface{}{"key": key, "value": value})
+	}
+	return sortRendered(rendered)
+}
+
+func renderAnys(xs []*any.Any) ([]interface{}, error) {
+	rendered := make([]interface{}, 0, len(xs))
+	for _, x := range xs {
+		r, err := renderAny(x)
+		if err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, r)
+	}
+	return sortRendered(rendered)
+}
+
+// renderAny decodes x to be rendered as JSON.
+func renderAny(x *any.Any) (interface{}, error) {
+	switch {
+	case x == nil:
+		return nil, nil
+	case strings.HasPrefix(x.GetTypeUrl(), encoding.PrimitiveTypeURLPrefix):
+		return encoding.UnmarshalPrimitive(x)
+	case strings.HasPrefix(x.GetTypeUrl(), encoding.JSONTypeURLPrefix):
+		var raw json.RawMessage
+		if err := encoding.UnmarshalJSON(x, &raw); err != nil {
+			return nil, err
+		}
+		return raw, nil
+	}
+	s, err := (&jsonpb.Marshaler{}).MarshalToString(x)
+	if err != nil {
+		// the message type is not registered.
+		return map[string]interface{}{"@type": x.GetTypeUrl(), "value": x.GetValue()}, nil
+	}
+	return json.RawMessage(s), nil
+}
+
+// sortRendered sorts rendered values by their JSON encoding.
+func sortRendered(rendered []interface{}) ([]interface{}, error) {
+	keys := make([]string, len(rendered))
+	for i, r := range rendered {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = string(b)
+	}
+	sort.Sort(byKeys{keys, rendered})
+	return rendered, nil
+}
+
+type byKeys struct {
+	keys   []string
+	values []interface{}
+}
+
+func (b byKeys) Len() int           { return len(b.keys) }
+func (b byKeys) Less(i, j int) bool { return b.keys[i] < b.keys[j] }
+func (b byKeys) Swap(i, j int) {
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+	b.values[i], b.values[j] = b.values[j], b.values[i]
+}
+
+func values(m map[anyKey]*any.Any) []*any.Any {
+	xs := make([]*any.Any, 0, len(m))
+	for _, x := range m {
+		xs = append(xs, x)
+	}
+	return xs
+}
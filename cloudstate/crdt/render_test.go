@@ -0,0 +1,126 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdt
+
+import (
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func TestRenderJSON(t *testing.T) {
+	t.Run("a counter renders its value and delta", func(t *testing.T) {
+		c := NewGCounter()
+		c.Increment(3)
+		c.resetDelta()
+		c.Increment(2)
+		got, err := RenderJSON(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{
+  "delta": {
+    "increment": 2
+  },
+  "type": "GCounter",
+  "value": 5
+}`
+		if string(got) != want {
+			t.Fatalf("RenderJSON() = %s; want: %s", got, want)
+		}
+	})
+
+	t.Run("nested maps render sorted and decoded", func(t *testing.T) {
+		inner := NewORMap()
+		register, err := encoding.MarshalAny(&wrappers.StringValue{Value: "v"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		inner.Set(encoding.String("register"), NewLWWRegisterWithClock(register, Custom, 7))
+		json, err := encoding.JSON(struct {
+			A int `json:"a"`
+		}{1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		set := NewORSet()
+		set.Add(json)
+		set.Add(encoding.Int64(2))
+		m := NewORMap()
+		m.Set(encoding.String("b"), inner)
+		m.Set(encoding.String("a"), set)
+		m.resetDelta()
+		set.Remove(encoding.Int64(2))
+		got, err := RenderJSON(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{
+  "delta": {
+    "added": [],
+    "cleared": false,
+    "removed": []
+  },
+  "type": "ORMap",
+  "value": [
+    {
+      "key": "a",
+      "value": {
+        "delta": {
+          "added": [],
+          "cleared": false,
+          "removed": [
+            2
+          ]
+        },
+        "type": "ORSet",
+        "value": [
+          {
+            "a": 1
+          }
+        ]
+      }
+    },
+    {
+      "key": "b",
+      "value": {
+        "type": "ORMap",
+        "value": [
+          {
+            "key": "register",
+            "value": {
+              "type": "LWWRegister",
+              "value": {
+                "clock": "CUSTOM",
+                "customClockValue": 7,
+                "value": {
+                  "@type": "type.googleapis.com/google.protobuf.StringValue",
+                  "value": "v"
+                }
+              }
+            }
+          }
+        ]
+      }
+    }
+  ]
+}`
+		if string(got) != want {
+			t.Fatalf("RenderJSON() = %s; want: %s", got, want)
+		}
+	})
+}
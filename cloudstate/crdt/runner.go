@@ -16,11 +16,16 @@
 package crdt
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/internal/timeout"
+	"github.com/cloudstateio/go-support/cloudstate/metrics"
 	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/ptypes/any"
 )
 
 // runner runs a stream with the help of a context.
@@ -33,6 +38,9 @@ type runner struct {
 // A delta to be applied to the current value. It may be sent at any time as long
 // as the user function already has value.
 func (r *runner) handleDelta(delta *entity.CrdtDelta) error {
+	if err := r.context.Entity.Schema.validateDelta(delta); err != nil {
+		return err
+	}
 	if r.context.crdt == nil {
 		s, err := newFor(delta)
 		if err != nil {
@@ -64,6 +72,9 @@ func (r *runner) handleCancellation(cancelled *protocol.StreamCancelled) error {
 		return err
 	}
 	stateAction := ctx.stateAction()
+	if err := r.context.Entity.Schema.validateDelta(stateAction.GetUpdate()); err != nil {
+		return err
+	}
 	err := r.sendCancelledMessage(&entity.CrdtStreamCancelledResponse{
 		CommandId:   id.Value(),
 		StateAction: stateAction,
@@ -72,10 +83,13 @@ func (r *runner) handleCancellation(cancelled *protocol.StreamCancelled) error {
 	if err != nil {
 		return err
 	}
+	if r.context.deleted {
+		return r.handleDelete()
+	}
 	// The state has been changed therefore streamed change handlers get
 	// informed.
 	if stateAction != nil {
-		return r.handleChange()
+		return r.handleChange(changesOfAction(stateAction))
 	}
 	return nil
 }
@@ -96,7 +110,37 @@ func (r *runner) handleCommand(cmd *protocol.Command) (streamError error) {
 		return fmt.Errorf("the command entity id: %s does not match the initialized entity id: %s", cmd.EntityId, r.context.EntityID)
 	}
 	ctx := r.context.commandContextFor(cmd)
-	reply, err := ctx.runCommand(cmd)
+	var reply *any.Any
+	var cmdErr error
+	err := timeout.Run(r.context.ctx, r.context.Entity.CommandTimeout, func(deadline context.Context) {
+		ctx.deadline = deadline
+		reply, cmdErr = ctx.runCommand(cmd)
+	})
+	if err == context.DeadlineExceeded {
+		// The handler still runs and might change the CRDT further, the
+		// entity therefore gets restarted.
+		metrics.CommandTimedOut(r.context.Entity.ServiceName.String())
+		if err := r.sendCrdtReply(&entity.CrdtReply{
+			CommandId: ctx.CommandID.Value(),
+			ClientAction: &protocol.ClientAction{
+				Action: &protocol.ClientAction_Failure{
+					Failure: &protocol.Failure{
+						CommandId:   ctx.CommandID.Value(),
+						Description: timeout.ErrCommandTimeout.Error(),
+						Restart:     true,
+					},
+				},
+			},
+		}); err != nil {
+			return err
+		}
+		return timeout.ErrCommandTimeout
+	}
+	if err != nil {
+		return err
+	}
+	ctx.deadline = nil
+	err = cmdErr
 	if err != nil && !errors.Is(err, protocol.ClientError{}) {
 		return err
 	}
@@ -125,6 +169,9 @@ func (r *runner) handleCommand(cmd *protocol.Command) (streamError error) {
 		})
 	}
 	stateAction := ctx.stateAction()
+	if err := r.context.Entity.Schema.validateDelta(stateAction.GetUpdate()); err != nil {
+		return err
+	}
 	err = r.sendCrdtReply(&entity.CrdtReply{
 		CommandId:    ctx.CommandID.Value(),
 		ClientAction: clientAction,
@@ -141,8 +188,15 @@ func (r *runner) handleCommand(cmd *protocol.Command) (streamError error) {
 		return err
 	}
 	ctx.clearSideEffect()
+	if r.context.deleted {
+		if ctx.Streamed() {
+			// the stream accepted gets ended as well.
+			ctx.trackChanges()
+		}
+		return r.handleDelete()
+	}
 	if stateAction != nil {
-		if err := r.handleChange(); err != nil {
+		if err := r.handleChange(changesOfAction(stateAction)); err != nil {
 			return err
 		}
 	}
@@ -152,11 +206,71 @@ func (r *runner) handleCommand(cmd *protocol.Command) (streamError error) {
 	return nil
 }
 
-func (r *runner) handleChange() error {
+// handleDelete calls the DeleteHandler of a deleted entity and ends its
+// streamed commands with a final message.
+func (r *runner) handleDelete() error {
+	if h, ok := r.context.Instance.(DeleteHandler); ok {
+		if err := h.OnDelete(r.context); err != nil {
+			return err
+		}
+	}
+	ids := make([]CommandID, 0, len(r.context.streamedCtx))
+	for id := range r.context.streamedCtx {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		delete(r.context.streamedCtx, id)
+		if err := r.sendStreamedMessage(&entity.CrdtStreamedMessage{
+			CommandId: id.Value(),
+			EndStream: true,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleDeleted handles a message received for a deleted entity. Commands
+// are rejected by a client failure, cancelled streams are acknowledged and
+// deltas are ignored.
+func (r *runner) handleDeleted(msg *entity.CrdtStreamIn) error {
+	switch m := msg.GetMessage().(type) {
+	case *entity.CrdtStreamIn_Command:
+		return r.sendCrdtReply(&entity.CrdtReply{
+			CommandId: m.Command.GetId(),
+			ClientAction: &protocol.ClientAction{
+				Action: &protocol.ClientAction_Failure{
+					Failure: &protocol.Failure{
+						CommandId:   m.Command.GetId(),
+						Description: fmt.Sprintf("the entity %q has been deleted", r.context.EntityID),
+					},
+				},
+			},
+		})
+	case *entity.CrdtStreamIn_StreamCancelled:
+		return r.sendCancelledMessage(&entity.CrdtStreamCancelledResponse{
+			CommandId: m.StreamCancelled.GetId(),
+		})
+	case *entity.CrdtStreamIn_Delta, *entity.CrdtStreamIn_Delete:
+		return nil
+	case nil:
+		return errors.New("empty message received")
+	default:
+		return fmt.Errorf("unknown message received: %+v", msg.GetMessage())
+	}
+}
+
+// handleChange calls the change functions of streamed commands selecting
+// the changes.
+func (r *runner) handleChange(changes *Changes) error {
 	for _, ctx := range r.context.streamedCtx {
 		if ctx.change == nil {
 			continue
 		}
+		if ctx.changeIf != nil && !ctx.changeIf(changes) {
+			continue
+		}
 		reply, err := ctx.changed()
 
 		// TODO: we have to clarify error path from here on.
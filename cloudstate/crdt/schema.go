@@ -0,0 +1,225 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdt
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// A Type is the type of a CRDT as it is replicated. ORMultiMap, LWWMap and
+// PNCounterMap are replicated as an ORMap.
+type Type string
+
+const (
+	FlagType        Type = "Flag"
+	GCounterType    Type = "GCounter"
+	GSetType        Type = "GSet"
+	LWWRegisterType Type = "LWWRegister"
+	ORMapType       Type = "ORMap"
+	ORSetType       Type = "ORSet"
+	PNCounterType   Type = "PNCounter"
+	VoteType        Type = "Vote"
+)
+
+// A Schema describes the types of the CRDT of an entity. If an entity has a
+// schema, its CRDT is validated when the entity is initialized, deltas
+// received are validated before they are applied, and deltas of state
+// actions are validated before they are sent.
+type Schema struct {
+	// Type is the type of the CRDT. Setting it is mandatory.
+	Type Type
+	// Values describes the values of an ORMap by their keys. The first
+	// ValueSchema with a KeyPattern matching a key applies. Values with
+	// keys not matched are not validated.
+	Values []ValueSchema
+}
+
+// A ValueSchema describes the values of an ORMap with keys matching a
+// pattern.
+type ValueSchema struct {
+	// KeyPattern is matched by path.Match against keys. Primitive keys are
+	// matched by their value, other keys by their type URL.
+	KeyPattern string
+	Schema     Schema
+}
+
+// check checks the types and key patterns of the schema.
+func (s *Schema) check() error {
+	if s.Type == "" {
+		return errors.New("the schema has to define a Type but did not")
+	}
+	for _, v := range s.Values {
+		if _, err := path.Match(v.KeyPattern, ""); err != nil {
+			return fmt.Errorf("invalid key pattern %q: %w", v.KeyPattern, err)
+		}
+		if err := v.Schema.check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate validates c against the schema. A nil schema validates any CRDT.
+func (s *Schema) validate(c CRDT) error {
+	if s == nil {
+		return nil
+	}
+	return s.validateAt("root", c)
+}
+
+func (s *Schema) validateAt(at string, c CRDT) error {
+	if t := typeOf(c); t != s.Type {
+		return fmt.Errorf("the CRDT at %s is of type: %s, but the schema requires: %s", at, t, s.Type)
+	}
+	m := asORMap(c)
+	if m == nil {
+		return nil
+	}
+	for _, e := range m.Entries() {
+		v := s.valueSchema(e.Key)
+		if v == nil {
+			continue
+		}
+		if err := v.validateAt(keyAt(at, e.Key), e.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateDelta validates delta against the schema. A nil schema or a nil
+// delta is valid.
+func (s *Schema) validateDelta(delta *entity.CrdtDelta) error {
+	if s == nil || delta == nil {
+		return nil
+	}
+	return s.validateDeltaAt("root", delta)
+}
+
+func (s *Schema) validateDeltaAt(at string, delta *entity.CrdtDelta) error {
+	if t := typeOfDelta(delta); t != s.Type {
+		return fmt.Errorf("the delta at %s is of type: %s, but the schema requires: %s", at, t, s.Type)
+	}
+	d := delta.GetOrmap()
+	if d == nil {
+		return nil
+	}
+	for _, entries := range [][]*entity.ORMapEntryDelta{d.GetAdded(), d.GetUpdated()} {
+		for _, e := range entries {
+			v := s.valueSchema(e.GetKey())
+			if v == nil {
+				continue
+			}
+			if err := v.validateDeltaAt(keyAt(at, e.GetKey()), e.GetDelta()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) valueSchema(key *any.Any) *Schema {
+	k := keyName(key)
+	for i, v := range s.Values {
+		if ok, _ := path.Match(v.KeyPattern, k); ok {
+			return &s.Values[i].Schema
+		}
+	}
+	return nil
+}
+
+// keyName is the name of a key to be matched by key patterns.
+func keyName(key *any.Any) string {
+	if strings.HasPrefix(key.GetTypeUrl(), encoding.PrimitiveTypeURLPrefix) {
+		if v, err := encoding.UnmarshalPrimitive(key); err == nil {
+			return fmt.Sprint(v)
+		}
+	}
+	return key.GetTypeUrl()
+}
+
+func keyAt(at string, key *any.Any) string {
+	return fmt.Sprintf("%s[%q]", at, keyName(key))
+}
+
+func typeOf(c CRDT) Type {
+	switch c.(type) {
+	case *Flag:
+		return FlagType
+	case *GCounter:
+		return GCounterType
+	case *GSet:
+		return GSetType
+	case *LWWRegister:
+		return LWWRegisterType
+	case *ORMap, *ORMultiMap, *LWWMap, *PNCounterMap:
+		return ORMapType
+	case *ORSet:
+		return ORSetType
+	case *PNCounter:
+		return PNCounterType
+	case *Vote:
+		return VoteType
+	default:
+		return Type(fmt.Sprintf("%T", c))
+	}
+}
+
+func typeOfDelta(delta *entity.CrdtDelta) Type {
+	switch d := delta.GetDelta().(type) {
+	case *entity.CrdtDelta_Flag:
+		return FlagType
+	case *entity.CrdtDelta_Gcounter:
+		return GCounterType
+	case *entity.CrdtDelta_Gset:
+		return GSetType
+	case *entity.CrdtDelta_Lwwregister:
+		return LWWRegisterType
+	case *entity.CrdtDelta_Ormap:
+		return ORMapType
+	case *entity.CrdtDelta_Orset:
+		return ORSetType
+	case *entity.CrdtDelta_Pncounter:
+		return PNCounterType
+	case *entity.CrdtDelta_Vote:
+		return VoteType
+	default:
+		return Type(fmt.Sprintf("%T", d))
+	}
+}
+
+// asORMap returns the ORMap c is or is composed from, if any.
+func asORMap(c CRDT) *ORMap {
+	switch c := c.(type) {
+	case *ORMap:
+		return c
+	case *ORMultiMap:
+		return c.m
+	case *LWWMap:
+		return c.m
+	case *PNCounterMap:
+		return c.m
+	default:
+		return nil
+	}
+}
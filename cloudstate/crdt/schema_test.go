@@ -0,0 +1,199 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+var countersSchema = &Schema{
+	Type: ORMapType,
+	Values: []ValueSchema{
+		{KeyPattern: "count-*", Schema: Schema{Type: PNCounterType}},
+		{KeyPattern: "tags", Schema: Schema{Type: ORSetType}},
+	},
+}
+
+func TestSchema(t *testing.T) {
+	t.Run("should validate a CRDT", func(t *testing.T) {
+		m := NewORMap()
+		m.Set(encoding.String("count-a"), NewPNCounter())
+		m.Set(encoding.String("other"), NewFlag())
+		if err := countersSchema.validate(m); err != nil {
+			t.Fatal(err)
+		}
+		m.Set(encoding.String("tags"), NewGSet())
+		err := countersSchema.validate(m)
+		if err == nil {
+			t.Fatal("a GSet at tags should be invalid")
+		}
+		if want := `the CRDT at root["tags"] is of type: GSet, but the schema requires: ORSet`; err.Error() != want {
+			t.Fatalf("err: %q; want: %q", err, want)
+		}
+		if err := countersSchema.validate(NewPNCounterMap()); err != nil {
+			t.Fatal(err)
+		}
+		if err := countersSchema.validate(NewGCounter()); err == nil {
+			t.Fatal("a GCounter should be invalid")
+		}
+	})
+	t.Run("should validate a delta", func(t *testing.T) {
+		m := NewPNCounterMap()
+		m.Increment(encoding.String("count-a"), 1)
+		if err := countersSchema.validateDelta(m.Delta()); err != nil {
+			t.Fatal(err)
+		}
+		o := NewORMap()
+		o.Set(encoding.String("count-b"), NewGCounter())
+		if err := countersSchema.validateDelta(o.Delta()); err == nil {
+			t.Fatal("a GCounter at count-b should be invalid")
+		}
+	})
+	t.Run("should not register an invalid schema", func(t *testing.T) {
+		for _, schema := range []*Schema{
+			{Type: ORMapType, Values: []ValueSchema{{KeyPattern: "[", Schema: Schema{Type: PNCounterType}}}},
+			{},
+			{Type: ORMapType, Values: []ValueSchema{{KeyPattern: "count-*"}}},
+		} {
+			err := NewServer().Register(&Entity{
+				ServiceName: "invalid",
+				EntityFunc:  func(EntityID) EntityHandler { return &counters{} },
+				Schema:      schema,
+			})
+			if err == nil {
+				t.Fatalf("Register() = nil for schema %+v; want an error", schema)
+			}
+		}
+	})
+}
+
+// counters is an entity of PNCounters by keys that sets values of other
+// types if told so.
+type counters struct {
+	m *ORMap
+}
+
+func (e *counters) HandleCommand(_ *CommandContext, _ string, msg proto.Message) (*any.Any, error) {
+	key := msg.(*wrappers.StringValue).GetValue()
+	if strings.HasSuffix(key, "-flag") {
+		e.m.Set(encoding.String(key), NewFlag())
+	} else {
+		PNCounterMapOf(e.m).Increment(encoding.String(key), 1)
+	}
+	return encoding.MarshalAny(&wrappers.StringValue{})
+}
+
+func (e *counters) Default(*Context) (CRDT, error) {
+	return NewORMap(), nil
+}
+
+func (e *counters) Set(_ *Context, state CRDT) error {
+	e.m = asORMap(state)
+	return nil
+}
+
+func TestSchemaValidation(t *testing.T) {
+	newServer := func(t *testing.T) *Server {
+		server := NewServer()
+		err := server.Register(&Entity{
+			ServiceName: "counters",
+			EntityFunc:  func(EntityID) EntityHandler { return &counters{} },
+			Schema:      countersSchema,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return server
+	}
+	newStream := func(t *testing.T, delta *entity.CrdtDelta, keys ...string) *stream {
+		s := &stream{in: []*entity.CrdtStreamIn{{
+			Message: &entity.CrdtStreamIn_Init{Init: &entity.CrdtInit{ServiceName: "counters", EntityId: "entity-0", Delta: delta}},
+		}}}
+		for i, key := range keys {
+			payload, err := encoding.MarshalAny(&wrappers.StringValue{Value: key})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.in = append(s.in, &entity.CrdtStreamIn{Message: &entity.CrdtStreamIn_Command{Command: &protocol.Command{
+				EntityId: "entity-0",
+				Id:       int64(i + 1),
+				Payload:  payload,
+			}}})
+		}
+		return s
+	}
+	failure := func(s *stream) string {
+		for _, out := range s.sent {
+			if f := out.GetFailure(); f != nil {
+				return f.GetDescription()
+			}
+		}
+		return ""
+	}
+
+	t.Run("valid commands are handled", func(t *testing.T) {
+		s := newStream(t, nil, "count-a", "count-b", "other-flag")
+		if err := newServer(t).Handle(s); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(s.sent); got != 3 {
+			t.Fatalf("len(sent): %d; want: 3", got)
+		}
+	})
+	t.Run("an init delta of another type fails", func(t *testing.T) {
+		s := newStream(t, &entity.CrdtDelta{Delta: &entity.CrdtDelta_Gcounter{Gcounter: &entity.GCounterDelta{}}})
+		if err := newServer(t).Handle(s); err == nil {
+			t.Fatal("Handle() = nil; want an error")
+		}
+		if got := failure(s); !strings.Contains(got, "schema requires: ORMap") {
+			t.Fatalf("failure: %q; want a schema failure", got)
+		}
+	})
+	t.Run("a value of another type set locally fails", func(t *testing.T) {
+		s := newStream(t, nil, "count-a", "count-flag")
+		if err := newServer(t).Handle(s); err == nil {
+			t.Fatal("Handle() = nil; want an error")
+		}
+		if got := failure(s); !strings.Contains(got, `root["count-flag"] is of type: Flag`) {
+			t.Fatalf("failure: %q; want a schema failure", got)
+		}
+	})
+	t.Run("a delta with a value of another type fails", func(t *testing.T) {
+		s := newStream(t, nil)
+		s.in = append(s.in, &entity.CrdtStreamIn{Message: &entity.CrdtStreamIn_Delta{Delta: &entity.CrdtDelta{
+			Delta: &entity.CrdtDelta_Ormap{Ormap: &entity.ORMapDelta{
+				Added: []*entity.ORMapEntryDelta{{
+					Key:   encoding.String("tags"),
+					Delta: &entity.CrdtDelta{Delta: &entity.CrdtDelta_Gset{Gset: &entity.GSetDelta{}}},
+				}},
+			}},
+		}}})
+		if err := newServer(t).Handle(s); err == nil {
+			t.Fatal("Handle() = nil; want an error")
+		}
+		if got := failure(s); !strings.Contains(got, `root["tags"] is of type: GSet`) {
+			t.Fatalf("failure: %q; want a schema failure", got)
+		}
+	})
+}
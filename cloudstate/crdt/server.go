@@ -23,6 +23,7 @@ import (
 	"sync"
 
 	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/internal/timeout"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -52,6 +53,11 @@ func (s *Server) Register(e *Entity) error {
 	if e.EntityFunc == nil {
 		return errors.New("the entity has to define an EntityFunc but did not")
 	}
+	if e.Schema != nil {
+		if err := e.Schema.check(); err != nil {
+			return fmt.Errorf("the entity schema is invalid: %w", err)
+		}
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, exists := s.entities[e.ServiceName]; exists {
@@ -116,12 +122,6 @@ func (s *Server) handle(stream entity.Crdt_HandleServer) error {
 	}
 	// Handle all other messages after a CrdtInit message has been received.
 	for {
-		if r.context.deleted {
-			// With a context flagged deleted, a CrdtDelete
-			// was received or delete state action was sent.
-			// Here we return no error and left the stream open.
-			return nil
-		}
 		if r.context.failed != nil {
 			// failed means deactivated. We may never get this far.
 			return nil
@@ -130,22 +130,45 @@ func (s *Server) handle(stream entity.Crdt_HandleServer) error {
 		if err != nil {
 			return err
 		}
+		if r.context.deleted {
+			// With a context flagged deleted, a CrdtDelete was received or
+			// a delete state action was sent. The stream stays open to
+			// reject commands until a new entity is initialized.
+			if init := msg.GetInit(); init != nil {
+				if err := s.handleInit(init, r); err != nil {
+					return fmt.Errorf("handling of CrdtInit failed with: %w", err)
+				}
+				continue
+			}
+			if err := r.handleDeleted(msg); err != nil {
+				return err
+			}
+			continue
+		}
 		switch m := msg.GetMessage().(type) {
 		case *entity.CrdtStreamIn_Delta:
 			if err := r.handleDelta(m.Delta); err != nil {
 				return err
 			}
-			if err := r.handleChange(); err != nil {
+			if err := r.handleChange(changesOf(m.Delta)); err != nil {
 				return err
 			}
 		case *entity.CrdtStreamIn_Delete:
 			// Delete the entity. May be sent at any time. The user function should clear its value when it receives this.
 			// A proxy may decide to terminate the stream after sending this.
 			r.context.Delete()
+			r.context.crdt = nil
+			if err := r.handleDelete(); err != nil {
+				return err
+			}
 		case *entity.CrdtStreamIn_Command:
 			// A command, may be sent at any time.
 			// The CRDT is allowed to be changed.
-			if err := r.handleCommand(m.Command); err != nil {
+			if err := r.handleCommand(m.Command); err == timeout.ErrCommandTimeout {
+				// The entity is restarted by the proxy, the stream is closed
+				// as the handler still runs.
+				return io.EOF
+			} else if err != nil {
 				return err
 			}
 		case *entity.CrdtStreamIn_StreamCancelled:
@@ -196,5 +219,8 @@ func (s *Server) handleInit(init *entity.CrdtInit, r *runner) error {
 		}
 	}
 	// The user entity can provide a CRDT through a default function if none is set.
-	return r.context.initDefault()
+	if err := r.context.initDefault(); err != nil {
+		return err
+	}
+	return entity.Schema.validate(r.context.crdt)
 }
@@ -0,0 +1,393 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sim simulates replicas of a CRDT entity to test it for convergence
+// without a cluster of proxies.
+//
+// A Sim runs commands on chosen replicas and captures the deltas each
+// replica emits. Delivering them to the other replicas in any order, the
+// replicas are expected to converge to the same value once all deltas are
+// delivered.
+//
+// The deltas are delivered as they were emitted, while a proxy merges them
+// before it passes them on. Deltas that need the proxy to be merged, like the
+// ones of a Vote, are therefore not supported. Every delta is delivered once
+// to every other replica, duplicated deliveries are out of scope, as deltas
+// of counters are not idempotent. The package is meant to be used by tests
+// only.
+package sim
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+
+	"github.com/cloudstateio/go-support/cloudstate/crdt"
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/grpc"
+)
+
+// Delivery is a delta emitted by a replica to be delivered to another one.
+type Delivery struct {
+	// From is the replica the delta was emitted by.
+	From int
+	// To is the replica the delta is to be delivered to.
+	To    int
+	Delta *entity.CrdtStreamIn
+}
+
+// Sim simulates replicas of a CRDT entity.
+type Sim struct {
+	replicas []*replica
+	pending  []Delivery
+	seq      int64
+}
+
+// New returns a Sim with n replicas of the entity e, each of them initialized
+// for the entity id.
+func New(e *crdt.Entity, id crdt.EntityID, n int) (*Sim, error) {
+	if n < 1 {
+		return nil, errors.New("a simulation needs at least one replica")
+	}
+	s := &Sim{replicas: make([]*replica, n)}
+	for i := range s.replicas {
+		r, err := newReplica(e, id)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+		s.replicas[i] = r
+	}
+	return s, nil
+}
+
+// Command runs a command on the replica and returns the reply of the
+// command. The state action emitted by the command is queued to be delivered
+// to every other replica. A client failure is returned as a
+// protocol.ClientError.
+func (s *Sim) Command(replica int, name string, msg proto.Message) (*any.Any, error) {
+	r, err := s.replica(replica)
+	if err != nil {
+		return nil, err
+	}
+	if r.deleted {
+		return nil, fmt.Errorf("replica %d is deleted", replica)
+	}
+	payload, err := encoding.MarshalAny(msg)
+	if err != nil {
+		return nil, err
+	}
+	s.seq++
+	out, err := r.send(&entity.CrdtStreamIn{Message: &entity.CrdtStreamIn_Command{Command: &protocol.Command{
+		EntityId: r.id.String(),
+		Id:       s.seq,
+		Name:     name,
+		Payload:  payload,
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range out {
+		if f := o.GetFailure(); f != nil {
+			return nil, fmt.Errorf("replica %d failed: %s", replica, f.GetDescription())
+		}
+		reply := o.GetReply()
+		if reply == nil || reply.GetCommandId() != s.seq {
+			continue
+		}
+		if f := reply.GetClientAction().GetFailure(); f != nil {
+			return nil, protocol.ClientError{Err: errors.New(f.GetDescription())}
+		}
+		if reply.GetStateAction().GetDelete() != nil {
+			r.deleted = true
+		}
+		s.emit(replica, reply.GetStateAction())
+		return reply.GetClientAction().GetReply().GetPayload(), nil
+	}
+	return nil, fmt.Errorf("replica %d did not reply to command: %q", replica, name)
+}
+
+// emit queues the state action of a replica to be delivered to all others.
+func (s *Sim) emit(from int, action *entity.CrdtStateAction) {
+	var msg *entity.CrdtStreamIn
+	switch {
+	case action.GetUpdate() != nil:
+		msg = &entity.CrdtStreamIn{Message: &entity.CrdtStreamIn_Delta{Delta: action.GetUpdate()}}
+	case action.GetDelete() != nil:
+		msg = &entity.CrdtStreamIn{Message: &entity.CrdtStreamIn_Delete{Delete: action.GetDelete()}}
+	default:
+		return
+	}
+	for to := range s.replicas {
+		if to != from {
+			s.pending = append(s.pending, Delivery{From: from, To: to, Delta: msg})
+		}
+	}
+}
+
+// Pending returns the deliveries not yet delivered, in the order their
+// deltas were emitted.
+func (s *Sim) Pending() []Delivery {
+	return append([]Delivery(nil), s.pending...)
+}
+
+// Deliver delivers d and removes it from the pending deliveries. An error
+// is returned if d is not pending.
+func (s *Sim) Deliver(d Delivery) error {
+	pending := false
+	for i, p := range s.pending {
+		if p == d {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			pending = true
+			break
+		}
+	}
+	if !pending {
+		return fmt.Errorf("the delivery from replica %d to replica %d is not pending", d.From, d.To)
+	}
+	r, err := s.replica(d.To)
+	if err != nil {
+		return err
+	}
+	if r.deleted {
+		// a deleted entity receives no further deltas.
+		return nil
+	}
+	out, err := r.send(d.Delta)
+	if err != nil {
+		return err
+	}
+	for _, o := range out {
+		if f := o.GetFailure(); f != nil {
+			return fmt.Errorf("replica %d failed: %s", d.To, f.GetDescription())
+		}
+	}
+	if d.Delta.GetDelete() != nil {
+		r.deleted = true
+	}
+	return nil
+}
+
+// DeliverAll delivers all pending deliveries in the order their deltas were
+// emitted.
+func (s *Sim) DeliverAll() error {
+	for len(s.pending) > 0 {
+		if err := s.Deliver(s.pending[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeliverShuffled delivers all pending deliveries in an order chosen by rnd.
+func (s *Sim) DeliverShuffled(rnd *rand.Rand) error {
+	for len(s.pending) > 0 {
+		if err := s.Deliver(s.pending[rnd.Intn(len(s.pending))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CRDT returns the CRDT of a replica. It is nil for a deleted replica.
+func (s *Sim) CRDT(replica int) crdt.CRDT {
+	r, err := s.replica(replica)
+	if err != nil || r.deleted || r.ctx == nil {
+		return nil
+	}
+	return r.ctx.CRDT()
+}
+
+// Converged returns an error if the CRDTs of the replicas, as rendered by
+// crdt.RenderJSON, differ or deliveries are pending.
+func (s *Sim) Converged() error {
+	if len(s.pending) > 0 {
+		return fmt.Errorf("%d deliveries are pending", len(s.pending))
+	}
+	first, err := crdt.RenderJSON(s.CRDT(0))
+	if err != nil {
+		return fmt.Errorf("replica 0: %w", err)
+	}
+	for i := 1; i < len(s.replicas); i++ {
+		v, err := crdt.RenderJSON(s.CRDT(i))
+		if err != nil {
+			return fmt.Errorf("replica %d: %w", i, err)
+		}
+		if !bytes.Equal(first, v) {
+			return fmt.Errorf("replica %d has value: %s; replica 0 has: %s", i, v, first)
+		}
+	}
+	return nil
+}
+
+// Close closes the streams of all replicas.
+func (s *Sim) Close() error {
+	var err error
+	for _, r := range s.replicas {
+		if r == nil {
+			continue
+		}
+		if cErr := r.close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
+
+func (s *Sim) replica(i int) (*replica, error) {
+	if i < 0 || i >= len(s.replicas) {
+		return nil, fmt.Errorf("no replica: %d", i)
+	}
+	return s.replicas[i], nil
+}
+
+// replica runs a crdt.Server for one replica of the entity.
+type replica struct {
+	id      crdt.EntityID
+	stream  *stream
+	ctx     *crdt.Context
+	deleted bool
+	done    chan error
+	// stopped is set once the server has stopped handling the stream.
+	stopped bool
+}
+
+func newReplica(e *crdt.Entity, id crdt.EntityID) (*replica, error) {
+	r := &replica{
+		id: id,
+		stream: &stream{
+			in:      make(chan *entity.CrdtStreamIn),
+			waiting: make(chan struct{}),
+		},
+		done: make(chan error, 1),
+	}
+	entityFunc := e.EntityFunc
+	replicated := *e
+	replicated.EntityFunc = func(id crdt.EntityID) crdt.EntityHandler {
+		return handler{EntityHandler: entityFunc(id), r: r}
+	}
+	server := crdt.NewServer()
+	if err := server.Register(&replicated); err != nil {
+		return nil, err
+	}
+	go func() {
+		r.done <- server.Handle(r.stream)
+	}()
+	if err := r.wait(); err != nil {
+		return nil, err
+	}
+	_, err := r.send(&entity.CrdtStreamIn{Message: &entity.CrdtStreamIn_Init{Init: &entity.CrdtInit{
+		ServiceName: e.ServiceName.String(),
+		EntityId:    id.String(),
+	}}})
+	return r, err
+}
+
+// send sends msg to the replica and returns the messages sent by the replica
+// until it waits for the next one.
+func (r *replica) send(msg *entity.CrdtStreamIn) ([]*entity.CrdtStreamOut, error) {
+	r.stream.out = nil
+	if r.stopped {
+		return nil, errors.New("the replica has stopped")
+	}
+	select {
+	case r.stream.in <- msg:
+	case err := <-r.done:
+		return nil, r.stop(err)
+	}
+	if err := r.wait(); err != nil {
+		return r.stream.out, err
+	}
+	return r.stream.out, nil
+}
+
+func (r *replica) wait() error {
+	select {
+	case <-r.stream.waiting:
+		return nil
+	case err := <-r.done:
+		return r.stop(err)
+	}
+}
+
+func (r *replica) stop(err error) error {
+	r.stopped = true
+	if err == nil {
+		return errors.New("the replica has stopped")
+	}
+	return err
+}
+
+func (r *replica) close() error {
+	if r.stopped {
+		return nil
+	}
+	r.stopped = true
+	close(r.stream.in)
+	return <-r.done
+}
+
+// handler records the context of a replica. Optional interfaces of the
+// wrapped handler are forwarded.
+type handler struct {
+	crdt.EntityHandler
+	r *replica
+}
+
+func (h handler) Set(ctx *crdt.Context, state crdt.CRDT) error {
+	h.r.ctx = ctx
+	return h.EntityHandler.Set(ctx, state)
+}
+
+func (h handler) OnDelete(ctx *crdt.Context) error {
+	if d, ok := h.EntityHandler.(crdt.DeleteHandler); ok {
+		return d.OnDelete(ctx)
+	}
+	return nil
+}
+
+// stream is the stream of a replica. It signals waiting before it receives
+// a message, so that messages sent are handled one at a time.
+type stream struct {
+	grpc.ServerStream
+	in      chan *entity.CrdtStreamIn
+	waiting chan struct{}
+	out     []*entity.CrdtStreamOut
+}
+
+func (s *stream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *stream) Send(out *entity.CrdtStreamOut) error {
+	s.out = append(s.out, out)
+	return nil
+}
+
+func (s *stream) Recv() (*entity.CrdtStreamIn, error) {
+	s.waiting <- struct{}{}
+	msg, ok := <-s.in
+	if !ok {
+		return nil, io.EOF
+	}
+	return msg, nil
+}
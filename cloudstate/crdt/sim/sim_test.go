@@ -0,0 +1,218 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sim
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/crdt"
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+// counter is a PNCounter entity adding the value of its commands.
+type counter struct {
+	c *crdt.PNCounter
+}
+
+func (e *counter) HandleCommand(ctx *crdt.CommandContext, name string, msg proto.Message) (*any.Any, error) {
+	switch name {
+	case "Add":
+		e.c.Increment(msg.(*wrappers.Int64Value).GetValue())
+	case "Delete":
+		ctx.Delete()
+	}
+	return encoding.MarshalAny(&wrappers.Int64Value{Value: e.c.Value()})
+}
+
+func (e *counter) Default(*crdt.Context) (crdt.CRDT, error) {
+	return crdt.NewPNCounter(), nil
+}
+
+func (e *counter) Set(_ *crdt.Context, state crdt.CRDT) error {
+	c, ok := state.(*crdt.PNCounter)
+	if !ok {
+		return errors.New("not a PNCounter")
+	}
+	e.c = c
+	return nil
+}
+
+// deletable is a counter entity counting the deletes it is notified of.
+type deletable struct {
+	counter
+	deletes *int
+}
+
+func (e *deletable) OnDelete(*crdt.Context) error {
+	*e.deletes++
+	return nil
+}
+
+// set is a GSet entity adding the string of its commands.
+type set struct {
+	s *crdt.GSet
+}
+
+func (e *set) HandleCommand(_ *crdt.CommandContext, _ string, msg proto.Message) (*any.Any, error) {
+	e.s.Add(encoding.String(msg.(*wrappers.StringValue).GetValue()))
+	return encoding.MarshalAny(&empty.Empty{})
+}
+
+func (e *set) Default(*crdt.Context) (crdt.CRDT, error) {
+	return crdt.NewGSet(), nil
+}
+
+func (e *set) Set(_ *crdt.Context, state crdt.CRDT) error {
+	e.s = state.(*crdt.GSet)
+	return nil
+}
+
+func newSim(t *testing.T, h func() crdt.EntityHandler, n int) *Sim {
+	t.Helper()
+	s, err := New(&crdt.Entity{
+		ServiceName: "sim",
+		EntityFunc:  func(crdt.EntityID) crdt.EntityHandler { return h() },
+	}, "entity-0", n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestConvergence(t *testing.T) {
+	t.Run("a counter converges with deltas shuffled", func(t *testing.T) {
+		for seed := int64(0); seed < 20; seed++ {
+			s := newSim(t, func() crdt.EntityHandler { return &counter{} }, 3)
+			rnd := rand.New(rand.NewSource(seed))
+			for i := 0; i < 10; i++ {
+				if _, err := s.Command(rnd.Intn(3), "Add", &wrappers.Int64Value{Value: int64(rnd.Intn(10) - 5)}); err != nil {
+					t.Fatal(err)
+				}
+				if rnd.Intn(3) == 0 {
+					if err := s.DeliverShuffled(rnd); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if err := s.DeliverShuffled(rnd); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Converged(); err != nil {
+				t.Fatalf("seed %d: %v", seed, err)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("a delivery is delivered once", func(t *testing.T) {
+		s := newSim(t, func() crdt.EntityHandler { return &counter{} }, 2)
+		defer s.Close()
+		if _, err := s.Command(0, "Add", &wrappers.Int64Value{Value: 1}); err != nil {
+			t.Fatal(err)
+		}
+		d := s.Pending()[0]
+		if err := s.Deliver(d); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Deliver(d); err == nil {
+			t.Fatal("Deliver() = nil for a delivery delivered before; want an error")
+		}
+		if err := s.Converged(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("a set converges with deltas shuffled", func(t *testing.T) {
+		s := newSim(t, func() crdt.EntityHandler { return &set{} }, 4)
+		defer s.Close()
+		rnd := rand.New(rand.NewSource(1))
+		for _, v := range []string{"a", "b", "c", "a", "d"} {
+			if _, err := s.Command(rnd.Intn(4), "Add", &wrappers.StringValue{Value: v}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.DeliverShuffled(rnd); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Converged(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := s.CRDT(2).(*crdt.GSet).Size(), 4; got != want {
+			t.Fatalf("Size() = %d; want: %d", got, want)
+		}
+	})
+
+	t.Run("a pending delivery is not converged", func(t *testing.T) {
+		s := newSim(t, func() crdt.EntityHandler { return &counter{} }, 2)
+		defer s.Close()
+		if _, err := s.Command(1, "Add", &wrappers.Int64Value{Value: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Converged(); err == nil {
+			t.Fatal("Converged() = nil; want an error")
+		}
+		if err := s.DeliverAll(); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Converged(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("a delete is delivered to all replicas", func(t *testing.T) {
+		s := newSim(t, func() crdt.EntityHandler { return &counter{} }, 3)
+		defer s.Close()
+		if _, err := s.Command(0, "Delete", &wrappers.Int64Value{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.DeliverAll(); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			if s.CRDT(i) != nil {
+				t.Fatalf("CRDT(%d) = %v; want: nil", i, s.CRDT(i))
+			}
+		}
+		if _, err := s.Command(1, "Add", &wrappers.Int64Value{Value: 1}); err == nil {
+			t.Fatal("Command() = nil; want an error for a deleted replica")
+		}
+	})
+	t.Run("a deleted replica notifies its delete handler", func(t *testing.T) {
+		deletes := 0
+		s := newSim(t, func() crdt.EntityHandler { return &deletable{deletes: &deletes} }, 3)
+		defer s.Close()
+		if _, err := s.Command(2, "Delete", &wrappers.Int64Value{}); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := deletes, 1; got != want {
+			t.Fatalf("deletes = %d; want: %d", got, want)
+		}
+		if err := s.DeliverAll(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := deletes, 3; got != want {
+			t.Fatalf("deletes = %d; want: %d", got, want)
+		}
+	})
+}
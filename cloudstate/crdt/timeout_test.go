@@ -0,0 +1,94 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/metrics"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+// blockingEntity blocks on commands named Block until their deadline.
+type blockingEntity struct {
+	c *GCounter
+}
+
+func (e *blockingEntity) HandleCommand(ctx *CommandContext, name string, _ proto.Message) (*any.Any, error) {
+	if name == "Block" {
+		<-ctx.StreamCtx().Done()
+	}
+	e.c.Increment(1)
+	return encoding.MarshalAny(&wrappers.UInt64Value{Value: e.c.Value()})
+}
+
+func (e *blockingEntity) Default(*Context) (CRDT, error) {
+	return NewGCounter(), nil
+}
+
+func (e *blockingEntity) Set(_ *Context, state CRDT) error {
+	e.c = state.(*GCounter)
+	return nil
+}
+
+func TestCommandTimeout(t *testing.T) {
+	server := NewServer()
+	err := server.Register(&Entity{
+		ServiceName:    "blocking",
+		EntityFunc:     func(EntityID) EntityHandler { return &blockingEntity{} },
+		CommandTimeout: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	command := func(id int64, name string) *entity.CrdtStreamIn {
+		return &entity.CrdtStreamIn{Message: &entity.CrdtStreamIn_Command{Command: &protocol.Command{
+			EntityId: "entity-0",
+			Id:       id,
+			Name:     name,
+			Payload:  encoding.String(""),
+		}}}
+	}
+	timeouts := metrics.CommandTimeouts("blocking")
+	s := &stream{in: []*entity.CrdtStreamIn{
+		{Message: &entity.CrdtStreamIn_Init{Init: &entity.CrdtInit{ServiceName: "blocking", EntityId: "entity-0"}}},
+		command(1, "Increment"),
+		command(2, "Block"),
+		command(3, "Increment"),
+	}}
+	if err := server.Handle(s); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(s.sent), 2; got != want {
+		t.Fatalf("len(sent) = %d; want: %d", got, want)
+	}
+	failure := s.sent[1].GetReply().GetClientAction().GetFailure()
+	if failure == nil || !failure.GetRestart() {
+		t.Fatalf("a client action failure with restart should have been sent: %+v", s.sent[1])
+	}
+	if got, want := len(s.in), 1; got != want {
+		t.Fatalf("len(in) = %d; want: %d, the stream should have been closed", got, want)
+	}
+	if got, want := metrics.CommandTimeouts("blocking"), timeouts+1; got != want {
+		t.Fatalf("CommandTimeouts() = %d; want: %d", got, want)
+	}
+}
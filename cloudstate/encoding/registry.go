@@ -0,0 +1,251 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoding
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// A Codec encodes values to and decodes values from Any messages with type
+// URLs of the prefix the codec is registered for with a Registry.
+type Codec interface {
+	// Encode encodes v. It returns ErrNotMarshalled for values the codec
+	// does not encode.
+	Encode(v interface{}) (*any.Any, error)
+	// Decode decodes x into a new value.
+	Decode(x *any.Any) (interface{}, error)
+	// DecodeInto decodes x into the value target points to.
+	DecodeInto(x *any.Any, target interface{}) error
+}
+
+// A Registry has codecs registered by the type URL prefixes they decode.
+// Values are encoded by the codec registered last that encodes them, so that
+// codecs registered later take precedence over more general ones.
+type Registry struct {
+	// mu protects the fields below.
+	mu       sync.RWMutex
+	codecs   map[string]Codec
+	prefixes []string
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{codecs: make(map[string]Codec)}
+}
+
+// DefaultRegistry is the Registry the entity runners of all state models
+// use to decode and encode commands, replies, events, snapshots and states.
+// It encodes protobuf messages, then primitive values and then any other
+// value as JSON. Codecs for further formats may be registered with it.
+var DefaultRegistry = newDefaultRegistry()
+
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	_ = r.Register(JSONTypeURLPrefix, JSONCodec{})
+	_ = r.Register(PrimitiveTypeURLPrefix, PrimitiveCodec{})
+	_ = r.Register(ProtoAnyBase, ProtoCodec{})
+	return r
+}
+
+// Register registers a codec for type URLs with the given prefix.
+func (r *Registry) Register(prefix string, c Codec) error {
+	if prefix == "" || strings.Contains(prefix, "/") {
+		return fmt.Errorf("invalid type URL prefix: %q", prefix)
+	}
+	if c == nil {
+		return errors.New("the codec must not be nil")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.codecs[prefix]; exists {
+		return fmt.Errorf("a codec for the type URL prefix %q is already registered", prefix)
+	}
+	r.codecs[prefix] = c
+	r.prefixes = append(r.prefixes, prefix)
+	return nil
+}
+
+// Encode encodes v by the codec registered last that encodes it.
+func (r *Registry) Encode(v interface{}) (*any.Any, error) {
+	if v == nil {
+		return nil, fmt.Errorf("unable to encode a nil value: %w", ErrNotMarshalled)
+	}
+	r.mu.RLock()
+	codecs := make([]Codec, len(r.prefixes))
+	for i, p := range r.prefixes {
+		codecs[len(codecs)-1-i] = r.codecs[p]
+	}
+	r.mu.RUnlock()
+	for _, c := range codecs {
+		x, err := c.Encode(v)
+		if errors.Is(err, ErrNotMarshalled) {
+			continue
+		}
+		return x, err
+	}
+	return nil, fmt.Errorf("no codec encodes a value of type %T: %w", v, ErrNotMarshalled)
+}
+
+// Decode decodes x by the codec registered for its type URL prefix.
+func (r *Registry) Decode(x *any.Any) (interface{}, error) {
+	c, err := r.codecFor(x)
+	if err != nil {
+		return nil, err
+	}
+	return c.Decode(x)
+}
+
+// DecodeMessage decodes x like Decode does. Values decoded that are no
+// protobuf messages, like JSON and primitive values, are returned as the
+// *any.Any x.
+func (r *Registry) DecodeMessage(x *any.Any) (proto.Message, error) {
+	v, err := r.Decode(x)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := v.(proto.Message); ok {
+		return m, nil
+	}
+	return x, nil
+}
+
+// DecodeInto decodes x into the value target points to, by the codec
+// registered for its type URL prefix.
+func (r *Registry) DecodeInto(x *any.Any, target interface{}) error {
+	c, err := r.codecFor(x)
+	if err != nil {
+		return err
+	}
+	return c.DecodeInto(x, target)
+}
+
+func (r *Registry) codecFor(x *any.Any) (Codec, error) {
+	prefix := TypeURLPrefix(x.GetTypeUrl())
+	r.mu.RLock()
+	c, ok := r.codecs[prefix]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no codec registered for the type URL %q: %w", x.GetTypeUrl(), ErrNotUnmarshalled)
+	}
+	return c, nil
+}
+
+// TypeURLPrefix returns the prefix of a type URL, its host without an
+// optional scheme.
+// see: https://developers.google.com/protocol-buffers/docs/reference/csharp/class/google/protobuf/well-known-types/any#typeurl
+func TypeURLPrefix(typeURL string) string {
+	if i := strings.Index(typeURL, "://"); i >= 0 {
+		typeURL = typeURL[i+len("://"):]
+	}
+	if i := strings.Index(typeURL, "/"); i >= 0 {
+		return typeURL[:i]
+	}
+	return typeURL
+}
+
+// ProtoCodec encodes protobuf messages and decodes them by the types
+// registered with the protobuf package.
+type ProtoCodec struct{}
+
+func (ProtoCodec) Encode(v interface{}) (*any.Any, error) {
+	if _, ok := v.(proto.Message); !ok {
+		return nil, ErrNotMarshalled
+	}
+	return MarshalAny(v)
+}
+
+func (ProtoCodec) Decode(x *any.Any) (interface{}, error) {
+	name := x.GetTypeUrl()[strings.LastIndex(x.GetTypeUrl(), "/")+1:]
+	messageType := proto.MessageType(name)
+	if messageType == nil {
+		return nil, fmt.Errorf("unknown message type: %q", name)
+	}
+	message, ok := reflect.New(messageType.Elem()).Interface().(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("messageType is no proto.Message: %v", messageType)
+	}
+	if err := proto.Unmarshal(x.GetValue(), message); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrMarshal)
+	}
+	return message, nil
+}
+
+func (ProtoCodec) DecodeInto(x *any.Any, target interface{}) error {
+	message, ok := target.(proto.Message)
+	if !ok {
+		return fmt.Errorf("a value of type %T is no proto.Message to decode %q into", target, x.GetTypeUrl())
+	}
+	if err := UnmarshalAny(x, message); err != nil {
+		return fmt.Errorf("%s: %w", err, ErrMarshal)
+	}
+	return nil
+}
+
+// PrimitiveCodec encodes and decodes the primitive values supported by
+// MarshalPrimitive.
+type PrimitiveCodec struct{}
+
+func (PrimitiveCodec) Encode(v interface{}) (*any.Any, error) {
+	return MarshalPrimitive(v)
+}
+
+func (PrimitiveCodec) Decode(x *any.Any) (interface{}, error) {
+	v, err := UnmarshalPrimitive(x)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, fmt.Errorf("unknown primitive type: %q: %w", x.GetTypeUrl(), ErrNotUnmarshalled)
+	}
+	return v, nil
+}
+
+func (c PrimitiveCodec) DecodeInto(x *any.Any, target interface{}) error {
+	v, err := c.Decode(x)
+	if err != nil {
+		return err
+	}
+	t := reflect.ValueOf(target)
+	if t.Kind() != reflect.Ptr || t.IsNil() || t.Elem().Type() != reflect.TypeOf(v) {
+		return fmt.Errorf("a value of type %T can't be decoded into a value of type %T", v, target)
+	}
+	t.Elem().Set(reflect.ValueOf(v))
+	return nil
+}
+
+// JSONCodec encodes values as JSON by MarshalJSON. As Go types can't be
+// looked up by their name, Decode returns the *any.Any it gets while
+// DecodeInto decodes into the value given.
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(v interface{}) (*any.Any, error) {
+	return MarshalJSON(v)
+}
+
+func (JSONCodec) Decode(x *any.Any) (interface{}, error) {
+	return x, nil
+}
+
+func (JSONCodec) DecodeInto(x *any.Any, target interface{}) error {
+	return UnmarshalJSON(x, target)
+}
@@ -0,0 +1,159 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoding
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+// upperCodec is a user-defined codec encoding upper cased strings.
+type upperCodec struct{}
+
+type upper string
+
+func (upperCodec) Encode(v interface{}) (*any.Any, error) {
+	s, ok := v.(upper)
+	if !ok {
+		return nil, ErrNotMarshalled
+	}
+	return &any.Any{TypeUrl: "upper.example.com/upper", Value: []byte(strings.ToUpper(string(s)))}, nil
+}
+
+func (upperCodec) Decode(x *any.Any) (interface{}, error) {
+	return upper(x.GetValue()), nil
+}
+
+func (c upperCodec) DecodeInto(x *any.Any, target interface{}) error {
+	*target.(*upper) = upper(x.GetValue())
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	r := newDefaultRegistry()
+	t.Run("encodes by the codec registered last", func(t *testing.T) {
+		for _, tc := range []struct {
+			v      interface{}
+			prefix string
+		}{
+			{&wrappers.StringValue{Value: "x"}, ProtoAnyBase},
+			{"x", PrimitiveTypeURLPrefix},
+			{int64(29), PrimitiveTypeURLPrefix},
+			{&a{B: "29", C: 29}, JSONTypeURLPrefix},
+		} {
+			x, err := r.Encode(tc.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := TypeURLPrefix(x.GetTypeUrl()); got != tc.prefix {
+				t.Fatalf("%T encoded with prefix: %q, want: %q", tc.v, got, tc.prefix)
+			}
+		}
+	})
+	t.Run("decodes by the type URL prefix", func(t *testing.T) {
+		x, _ := r.Encode(&wrappers.StringValue{Value: "x"})
+		v, err := r.Decode(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !proto.Equal(v.(proto.Message), &wrappers.StringValue{Value: "x"}) {
+			t.Fatalf("decoded: %v", v)
+		}
+		x, _ = r.Encode(int64(29))
+		if v, err = r.Decode(x); err != nil || v != int64(29) {
+			t.Fatalf("decoded: %v, %v", v, err)
+		}
+	})
+	t.Run("decodes JSON and primitive messages as the any.Any", func(t *testing.T) {
+		for _, v := range []interface{}{&a{B: "29", C: 29}, "x"} {
+			x, _ := r.Encode(v)
+			m, err := r.DecodeMessage(x)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m != x {
+				t.Fatalf("decoded: %v, want: %v", m, x)
+			}
+		}
+	})
+	t.Run("decodes into a value", func(t *testing.T) {
+		x, _ := r.Encode(&a{B: "29", C: 29})
+		s := a{}
+		if err := r.DecodeInto(x, &s); err != nil {
+			t.Fatal(err)
+		}
+		if s != (a{B: "29", C: 29}) {
+			t.Fatalf("decoded: %+v", s)
+		}
+		x, _ = r.Encode("x")
+		var str string
+		if err := r.DecodeInto(x, &str); err != nil || str != "x" {
+			t.Fatalf("decoded: %q, %v", str, err)
+		}
+		var i int32
+		if err := r.DecodeInto(x, &i); err == nil {
+			t.Fatal("expected an error decoding a string into an int32")
+		}
+	})
+	t.Run("fails for unknown type URLs", func(t *testing.T) {
+		_, err := r.Decode(&any.Any{TypeUrl: "unknown.example.com/x"})
+		if !errors.Is(err, ErrNotUnmarshalled) {
+			t.Fatalf("err: %v, want: %v", err, ErrNotUnmarshalled)
+		}
+		if _, err := r.Decode(&any.Any{TypeUrl: ProtoAnyBase + "/unknown.Message"}); err == nil {
+			t.Fatal("expected an error for an unknown message type")
+		}
+	})
+	t.Run("registers user-defined codecs", func(t *testing.T) {
+		r := newDefaultRegistry()
+		if err := r.Register("upper.example.com", upperCodec{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Register("upper.example.com", upperCodec{}); err == nil {
+			t.Fatal("expected an error registering a prefix twice")
+		}
+		x, err := r.Encode(upper("abc"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := r.Decode(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != upper("ABC") {
+			t.Fatalf("decoded: %v", v)
+		}
+	})
+}
+
+func TestTypeURLPrefix(t *testing.T) {
+	for url, want := range map[string]string{
+		"type.googleapis.com/google.protobuf.Empty": ProtoAnyBase,
+		"https://type.googleapis.com/a.B":           ProtoAnyBase,
+		"json.cloudstate.io/example.com/pkg.T":      JSONTypeURLPrefix,
+		PrimitiveTypeURLPrefixString:                PrimitiveTypeURLPrefix,
+		"no-slash":                                  "no-slash",
+	} {
+		if got := TypeURLPrefix(url); got != want {
+			t.Errorf("TypeURLPrefix(%q): %q, want: %q", url, got, want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudstate
+
+import (
+	"fmt"
+
+	"github.com/cloudstateio/go-support/cloudstate/eventsourced"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// eventDestination returns the EventDestination declared for a service
+// method by its cloudstate.eventing options.
+func eventDestination(service, method string) (*EventDestination, error) {
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("no descriptor found for service %q: %w", service, err)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("no method %q found for service %q", method, service)
+	}
+	eventing, ok := proto.GetExtension(md.Options(), E_Eventing).(*Eventing)
+	if !ok || eventing.GetOut() == nil {
+		return nil, fmt.Errorf("the method %s.%s declares no cloudstate.eventing out destination", service, method)
+	}
+	return eventing.GetOut(), nil
+}
+
+// validateEventPublisher validates that the method events of an entity are
+// published through declares an EventDestination.
+func validateEventPublisher(e *eventsourced.Entity) error {
+	p := e.EventPublisher
+	if p == nil {
+		return nil
+	}
+	service := p.ServiceName
+	if service == "" {
+		service = e.ServiceName
+	}
+	if _, err := eventDestination(service.String(), p.CommandName); err != nil {
+		return fmt.Errorf("invalid event publisher: %w", err)
+	}
+	return nil
+}
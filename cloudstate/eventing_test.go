@@ -0,0 +1,89 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudstate
+
+import (
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/eventsourced"
+	_ "github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// registerPublisherService registers a service with a method declaring an
+// eventing out destination and one declaring an eventing in source.
+func registerPublisherService(t *testing.T) {
+	t.Helper()
+	out := &descriptorpb.MethodOptions{}
+	proto.SetExtension(out, E_Eventing, &Eventing{
+		Out: &EventDestination{Destination: &EventDestination_Topic{Topic: "counter-events"}},
+	})
+	in := &descriptorpb.MethodOptions{}
+	proto.SetExtension(in, E_Eventing, &Eventing{
+		In: &EventSource{Source: &EventSource_Topic{Topic: "counter-events"}},
+	})
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("cloudstate/test/publisher.proto"),
+		Package:    proto.String("cloudstate.test"),
+		Dependency: []string{"google/protobuf/empty.proto"},
+		Syntax:     proto.String("proto3"),
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Publisher"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Publish"),
+				InputType:  proto.String(".google.protobuf.Empty"),
+				OutputType: proto.String(".google.protobuf.Empty"),
+				Options:    out,
+			}, {
+				Name:       proto.String("Subscribe"),
+				InputType:  proto.String(".google.protobuf.Empty"),
+				OutputType: proto.String(".google.protobuf.Empty"),
+				Options:    in,
+			}},
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := protoregistry.GlobalFiles.RegisterFile(fd); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateEventPublisher(t *testing.T) {
+	registerPublisherService(t)
+	for _, tc := range []struct {
+		name      string
+		publisher *eventsourced.EventPublisher
+		valid     bool
+	}{
+		{"no publisher", nil, true},
+		{"out destination", &eventsourced.EventPublisher{ServiceName: "cloudstate.test.Publisher", CommandName: "Publish"}, true},
+		{"unknown service", &eventsourced.EventPublisher{ServiceName: "cloudstate.test.Unknown", CommandName: "Publish"}, false},
+		{"unknown method", &eventsourced.EventPublisher{ServiceName: "cloudstate.test.Publisher", CommandName: "Unknown"}, false},
+		{"in source only", &eventsourced.EventPublisher{ServiceName: "cloudstate.test.Publisher", CommandName: "Subscribe"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateEventPublisher(&eventsourced.Entity{ServiceName: "cloudstate.test.Counter", EventPublisher: tc.publisher})
+			if valid := err == nil; valid != tc.valid {
+				t.Fatalf("validateEventPublisher() = %v; want valid: %v", err, tc.valid)
+			}
+		})
+	}
+}
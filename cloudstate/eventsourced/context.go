@@ -18,8 +18,9 @@ package eventsourced
 import (
 	"context"
 
-	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/cloudevents"
 	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes/any"
 )
 
@@ -37,6 +38,8 @@ type Context struct {
 	shouldSnapshot bool
 	forward        *protocol.Forward
 	sideEffects    []*protocol.SideEffect
+	command        *protocol.Command
+	replyMetadata  *protocol.Metadata
 }
 
 // Emit is called by a command handler.
@@ -51,7 +54,9 @@ func (c *Context) Emit(event interface{}) {
 	}
 	c.events = append(c.events, event)
 	c.eventSequence++
-	c.shouldSnapshot = c.shouldSnapshot || (c.eventSequence%c.EventSourcedEntity.SnapshotEvery == 0)
+	if every := c.EventSourcedEntity.SnapshotEvery; every > 0 {
+		c.shouldSnapshot = c.shouldSnapshot || (c.eventSequence%every == 0)
+	}
 }
 
 // Effect adds a side effect to be emitted. An effect is something whose
@@ -85,6 +90,43 @@ func (c *Context) Forward(forward *protocol.Forward) {
 	c.forward = forward
 }
 
+// Command returns the command the context is handling, or nil if the
+// context is not handling a command, like for events during recovery.
+func (c *Context) Command() *protocol.Command {
+	return c.command
+}
+
+// CommandName returns the name of the command the context is handling.
+func (c *Context) CommandName() string {
+	return c.command.GetName()
+}
+
+// CommandID returns the id of the command the context is handling.
+func (c *Context) CommandID() CommandID {
+	return CommandID(c.command.GetId())
+}
+
+// Metadata returns the metadata of the command the context is handling.
+func (c *Context) Metadata() *protocol.Metadata {
+	return c.command.GetMetadata()
+}
+
+// CloudEvent returns the CloudEvent attributes of the command the context
+// is handling, as described by cloudevents.FromMetadata.
+func (c *Context) CloudEvent() (cloudevents.Event, error) {
+	return cloudevents.FromMetadata(c.Metadata())
+}
+
+// SetReplyMetadata sets metadata to be sent with the reply to the command
+// the context is handling. A reply carries the metadata of the command,
+// where entries of the metadata set take precedence. If the command is
+// forwarded, the metadata set is added to the forward, where entries of the
+// forwards own metadata take precedence. Side effects carry their own
+// metadata only.
+func (c *Context) SetReplyMetadata(md *protocol.Metadata) {
+	c.replyMetadata = md
+}
+
 // StreamCtx returns the context.Context for the contexts' current running stream.
 func (c *Context) StreamCtx() context.Context {
 	return c.ctx
@@ -102,17 +144,15 @@ func (c *Context) reset() {
 	c.failed = nil
 	c.forward = nil
 	c.sideEffects = nil
+	c.command = nil
+	c.replyMetadata = nil
 }
 
 // marshalEventsAny marshals and the clears events emitted through the context.
 func (c *Context) marshalEventsAny() ([]*any.Any, error) {
 	events := make([]*any.Any, len(c.events))
 	for i, evt := range c.events {
-		if e, ok := evt.(*any.Any); ok {
-			events[i] = e
-			continue
-		}
-		event, err := encoding.MarshalAny(evt)
+		event, err := marshalEvent(evt)
 		if err != nil {
 			return nil, err
 		}
@@ -121,3 +161,20 @@ func (c *Context) marshalEventsAny() ([]*any.Any, error) {
 	c.events = make([]interface{}, 0)
 	return events, nil
 }
+
+// replyMetadataFor returns the metadata to be replied to a command, the
+// commands metadata with the reply metadata set taking precedence.
+func (c *Context) replyMetadataFor(command *protocol.Command) *protocol.Metadata {
+	return protocol.MergeMetadata(c.replyMetadata, command.GetMetadata())
+}
+
+// forwardWithMetadata returns the forward set, with the reply metadata
+// added to it.
+func (c *Context) forwardWithMetadata() *protocol.Forward {
+	if len(c.replyMetadata.GetEntries()) == 0 {
+		return c.forward
+	}
+	forward := proto.Clone(c.forward).(*protocol.Forward)
+	forward.Metadata = protocol.MergeMetadata(forward.Metadata, c.replyMetadata)
+	return forward
+}
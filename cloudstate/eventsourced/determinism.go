@@ -0,0 +1,316 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventsourced
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// ErrNonDeterministic is wrapped by errors reporting an entity whose
+// HandleEvent or HandleSnapshot does not deterministically produce the same
+// state for the same events.
+var ErrNonDeterministic = errors.New("non-deterministic event handling")
+
+// DeterminismCheck configures the verification of recovered entities.
+// When an entity is sampled, the events it was recovered from are recorded
+// and replayed with CheckDeterminism after its first command was received.
+// The replay runs off the stream of the entity, only the snapshot of the
+// recovered instance is taken before the command is handled.
+type DeterminismCheck struct {
+	// SampleRate is the fraction of recoveries to be verified, from 0 to 1.
+	SampleRate float64
+	// Rand is the source used to sample recoveries. It has to be set for a
+	// SampleRate above 0.
+	Rand *rand.Rand
+	// MaxEvents bounds the number of events recorded for a recovery.
+	// Recoveries with more events are not verified. It defaults to 1000.
+	MaxEvents int
+	// Equal compares instances of entities not implementing Snapshooter.
+	// Such entities can only be verified if Equal is set.
+	Equal func(a, b EntityHandler) bool
+	// Report is called for a failed verification. It defaults to logging
+	// the error. A failed verification does not fail the entity.
+	Report func(id EntityID, err error)
+
+	// mu protects Rand, which is not safe for concurrent use.
+	mu sync.Mutex
+}
+
+const maxEventsDefault = 1000
+
+func (dc *DeterminismCheck) sampled() bool {
+	if dc == nil || dc.SampleRate <= 0 || dc.Rand == nil {
+		return false
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.Rand.Float64() < dc.SampleRate
+}
+
+func (dc *DeterminismCheck) maxEvents() int {
+	if dc.MaxEvents <= 0 {
+		return maxEventsDefault
+	}
+	return dc.MaxEvents
+}
+
+func (dc *DeterminismCheck) equal() func(a, b EntityHandler) bool {
+	if dc == nil {
+		return nil
+	}
+	return dc.Equal
+}
+
+func (dc *DeterminismCheck) report(id EntityID, err error) {
+	if dc.Report != nil {
+		dc.Report(id, err)
+		return
+	}
+	log.Printf("determinism check failed for entity %q: %v", id, err)
+}
+
+// CheckDeterminism replays events on two fresh instances of the entity and
+// checks they end up in the same state. If the entity implements Snapshooter,
+// the state is compared by its snapshot, serialized deterministically, which
+// has to be byte-identical; also, every SnapshotEvery events a snapshot is
+// taken and an instance recovered from it has to end up in the same state as
+// a full replay. Entities not implementing Snapshooter are compared by the
+// Equal function of the entities DeterminismCheck and can't be verified
+// without one.
+//
+// A typical source of non-determinism is an event handler iterating over a
+// map or reading the clock. CheckDeterminism is meant to be used in tests;
+// Entity.DeterminismCheck samples it for recovered entities in production.
+func CheckDeterminism(e *Entity, id EntityID, events []*any.Any) error {
+	evts := make([]*entity.EventSourcedEvent, len(events))
+	for i, e := range events {
+		evts[i] = &entity.EventSourcedEvent{Sequence: int64(i + 1), Payload: e}
+	}
+	return checkDeterminism(e, id, nil, evts)
+}
+
+// checkDeterminism verifies an entity recovered from an optional snapshot
+// and the events following it.
+func checkDeterminism(e *Entity, id EntityID, snapshot *entity.EventSourcedSnapshot, events []*entity.EventSourcedEvent) error {
+	a, err := replayer(e, id, snapshot)
+	if err != nil {
+		return err
+	}
+	b, err := replayer(e, id, snapshot)
+	if err != nil {
+		return err
+	}
+	_, snapshots := a.context.Instance.(Snapshooter)
+	equal := e.DeterminismCheck.equal()
+	if !snapshots && equal == nil {
+		return fmt.Errorf("the entity %q neither implements Snapshooter nor has a DeterminismCheck.Equal to be verified", e.ServiceName)
+	}
+	var taken []*entity.EventSourcedSnapshot
+	for _, evt := range events {
+		if err := a.handleEvent(evt); err != nil {
+			return fmt.Errorf("replay failed at sequence %d: %w", evt.Sequence, err)
+		}
+		if err := b.handleEvent(evt); err != nil {
+			return fmt.Errorf("replay failed at sequence %d: %w", evt.Sequence, err)
+		}
+		if !snapshots || e.SnapshotEvery <= 0 || evt.Sequence%e.SnapshotEvery != 0 {
+			continue
+		}
+		s, err := a.compareSnapshots(b)
+		if err != nil {
+			return err
+		}
+		taken = append(taken, &entity.EventSourcedSnapshot{SnapshotSequence: evt.Sequence, Snapshot: s})
+	}
+	if !snapshots {
+		if !equal(a.context.Instance, b.context.Instance) {
+			return fmt.Errorf("replaying %d events twice resulted in different states: %w", len(events), ErrNonDeterministic)
+		}
+		return nil
+	}
+	final, err := a.compareSnapshots(b)
+	if err != nil {
+		return err
+	}
+	for _, s := range taken {
+		c, err := replayer(e, id, s)
+		if err != nil {
+			return err
+		}
+		for _, evt := range events {
+			if evt.Sequence <= s.SnapshotSequence {
+				continue
+			}
+			if err := c.handleEvent(evt); err != nil {
+				return fmt.Errorf("replay after snapshot at sequence %d failed at sequence %d: %w", s.SnapshotSequence, evt.Sequence, err)
+			}
+		}
+		recovered, err := c.snapshot()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(final.GetValue(), recovered.GetValue()) || final.GetTypeUrl() != recovered.GetTypeUrl() {
+			return fmt.Errorf("recovery from the snapshot at sequence %d resulted in a different state than a full replay: %w",
+				s.SnapshotSequence, ErrNonDeterministic,
+			)
+		}
+	}
+	return nil
+}
+
+// replayer returns a runner, not attached to a stream, for a fresh instance
+// of the entity recovered from an optional snapshot.
+func replayer(e *Entity, id EntityID, snapshot *entity.EventSourcedSnapshot) (*runner, error) {
+	r := &runner{
+		context: &Context{
+			EntityID:           id,
+			EventSourcedEntity: e,
+			Instance:           e.EntityFunc(id),
+			ctx:                context.Background(),
+		},
+	}
+	if snapshot != nil {
+		if err := r.handleInitSnapshot(snapshot); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// compareSnapshots takes snapshots of both runners entities and returns
+// one of them if they are byte-identical.
+func (r *runner) compareSnapshots(other *runner) (*any.Any, error) {
+	s0, err := r.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	s1, err := other.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(s0.GetValue(), s1.GetValue()) || s0.GetTypeUrl() != s1.GetTypeUrl() {
+		return nil, fmt.Errorf("replaying events up to sequence %d twice resulted in different snapshots: %w",
+			r.context.eventSequence, ErrNonDeterministic,
+		)
+	}
+	return s0, nil
+}
+
+// snapshot returns the deterministically serialized snapshot of the
+// runners entity.
+func (r *runner) snapshot() (*any.Any, error) {
+	s, err := r.context.Instance.(Snapshooter).Snapshot(r.context)
+	if err != nil {
+		return nil, fmt.Errorf("getting a snapshot has failed: %w", err)
+	}
+	message, ok := s.(proto.Message)
+	if !ok {
+		return encoding.DefaultRegistry.Encode(s)
+	}
+	buffer := proto.NewBuffer(make([]byte, 0))
+	buffer.SetDeterministic(true)
+	if err := buffer.Marshal(message); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, encoding.ErrMarshal)
+	}
+	return &any.Any{
+		TypeUrl: fmt.Sprintf("%s/%s", encoding.ProtoAnyBase, proto.MessageName(message)),
+		Value:   buffer.Bytes(),
+	}, nil
+}
+
+// recovery records what an entity was recovered from, for it to be verified
+// by a DeterminismCheck.
+type recovery struct {
+	snapshot *entity.EventSourcedSnapshot
+	events   []*entity.EventSourcedEvent
+}
+
+// recordEvent records an event the entity was recovered from. A recovery
+// with more events than the DeterminismCheck allows is not verified.
+func (r *runner) recordEvent(event *entity.EventSourcedEvent) {
+	if r.recovery == nil {
+		return
+	}
+	if len(r.recovery.events) == r.context.EventSourcedEntity.DeterminismCheck.maxEvents() {
+		r.recovery = nil
+		return
+	}
+	r.recovery.events = append(r.recovery.events, event)
+}
+
+// verifyRecovery checks that the entity recovered deterministically,
+// including that a fresh instance recovered the same way ends up in the
+// same state as the running one. The recovery is replayed in a goroutine,
+// the running instance is not accessed by it.
+func (r *runner) verifyRecovery() {
+	rec := r.recovery
+	r.recovery = nil
+	e := r.context.EventSourcedEntity
+	id := r.context.EntityID
+	var recovered *any.Any
+	if _, ok := r.context.Instance.(Snapshooter); ok {
+		s, err := r.snapshot()
+		if err != nil {
+			e.DeterminismCheck.report(id, err)
+			return
+		}
+		recovered = s
+	}
+	go func() {
+		err := checkDeterminism(e, id, rec.snapshot, rec.events)
+		if err == nil && recovered != nil {
+			err = compareRecovered(e, id, rec, recovered)
+		}
+		if err != nil {
+			e.DeterminismCheck.report(id, err)
+		}
+	}()
+}
+
+// compareRecovered compares the snapshot of a recovered instance with the
+// one of a fresh instance recovered the same way.
+func compareRecovered(e *Entity, id EntityID, rec *recovery, recovered *any.Any) error {
+	c, err := replayer(e, id, rec.snapshot)
+	if err != nil {
+		return err
+	}
+	for _, evt := range rec.events {
+		if err := c.handleEvent(evt); err != nil {
+			return err
+		}
+	}
+	s, err := c.snapshot()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(s.GetValue(), recovered.GetValue()) || s.GetTypeUrl() != recovered.GetTypeUrl() {
+		return fmt.Errorf("a fresh instance recovered from %d events resulted in a different state than the running one: %w",
+			len(rec.events), ErrNonDeterministic,
+		)
+	}
+	return nil
+}
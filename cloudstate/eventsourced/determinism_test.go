@@ -0,0 +1,269 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventsourced
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// clock emulates a non-deterministic source like time.Now().
+var clock int64
+
+// counter counts increments and, if nonDeterministic is set,
+// stamps its state with the clock.
+type counter struct {
+	value            int64
+	count            int64
+	nonDeterministic bool
+	lossySnapshot    bool
+}
+
+func (c *counter) HandleCommand(*Context, string, proto.Message) (proto.Message, error) {
+	return nil, nil
+}
+
+func (c *counter) HandleEvent(_ *Context, event interface{}) error {
+	switch evt := event.(type) {
+	case *IncrementByEvent:
+		c.value += evt.Value
+		c.count++
+		if c.nonDeterministic {
+			clock++
+			c.count = clock
+		}
+	}
+	return nil
+}
+
+func (c *counter) Snapshot(*Context) (interface{}, error) {
+	return fmt.Sprintf("%d/%d", c.value, c.count), nil
+}
+
+func (c *counter) HandleSnapshot(_ *Context, snapshot interface{}) error {
+	parts := strings.Split(snapshot.(string), "/")
+	v, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return err
+	}
+	c.value = v
+	if c.lossySnapshot {
+		return nil
+	}
+	n, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return err
+	}
+	c.count = n
+	return nil
+}
+
+// plainCounter does not implement Snapshooter.
+type plainCounter struct {
+	values map[int64]int64
+	stamp  int64
+}
+
+func (c *plainCounter) HandleCommand(*Context, string, proto.Message) (proto.Message, error) {
+	return nil, nil
+}
+
+func (c *plainCounter) HandleEvent(_ *Context, event interface{}) error {
+	if evt, ok := event.(*IncrementByEvent); ok {
+		c.values[evt.Value]++
+		clock++
+		c.stamp = clock
+	}
+	return nil
+}
+
+func increments(t *testing.T, n int) []*any.Any {
+	t.Helper()
+	events := make([]*any.Any, n)
+	for i := range events {
+		e, err := encoding.MarshalAny(&IncrementByEvent{Value: int64(i + 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		events[i] = e
+	}
+	return events
+}
+
+func TestCheckDeterminism(t *testing.T) {
+	newEntity := func(c counter) *Entity {
+		return &Entity{
+			ServiceName:   "counter",
+			SnapshotEvery: 3,
+			EntityFunc: func(EntityID) EntityHandler {
+				instance := c
+				return &instance
+			},
+		}
+	}
+	t.Run("a deterministic entity passes", func(t *testing.T) {
+		if err := CheckDeterminism(newEntity(counter{}), "c-1", increments(t, 10)); err != nil {
+			t.Fatalf("err = %v; want: nil", err)
+		}
+	})
+	t.Run("a non-deterministic event handler is reported", func(t *testing.T) {
+		err := CheckDeterminism(newEntity(counter{nonDeterministic: true}), "c-1", increments(t, 10))
+		if !errors.Is(err, ErrNonDeterministic) {
+			t.Fatalf("err = %v; want: %v", err, ErrNonDeterministic)
+		}
+	})
+	t.Run("recovery from a lossy snapshot is reported", func(t *testing.T) {
+		err := CheckDeterminism(newEntity(counter{lossySnapshot: true}), "c-1", increments(t, 10))
+		if !errors.Is(err, ErrNonDeterministic) {
+			t.Fatalf("err = %v; want: %v", err, ErrNonDeterministic)
+		}
+		if !strings.Contains(err.Error(), "snapshot at sequence 3") {
+			t.Fatalf("err = %v; want the snapshot sequence reported", err)
+		}
+	})
+	t.Run("entities without snapshots are compared by Equal", func(t *testing.T) {
+		e := &Entity{
+			ServiceName: "plain-counter",
+			EntityFunc: func(EntityID) EntityHandler {
+				return &plainCounter{values: make(map[int64]int64)}
+			},
+			DeterminismCheck: &DeterminismCheck{
+				Equal: func(a, b EntityHandler) bool {
+					return reflect.DeepEqual(a, b)
+				},
+			},
+		}
+		err := CheckDeterminism(e, "c-1", increments(t, 2))
+		if !errors.Is(err, ErrNonDeterministic) {
+			t.Fatalf("err = %v; want: %v", err, ErrNonDeterministic)
+		}
+	})
+	t.Run("entities without snapshots and Equal can't be verified", func(t *testing.T) {
+		e := &Entity{
+			ServiceName: "plain-counter",
+			EntityFunc: func(EntityID) EntityHandler {
+				return &plainCounter{values: make(map[int64]int64)}
+			},
+		}
+		err := CheckDeterminism(e, "c-1", increments(t, 2))
+		if err == nil || errors.Is(err, ErrNonDeterministic) {
+			t.Fatalf("err = %v; want an error for an entity that can't be verified", err)
+		}
+	})
+}
+
+func TestDeterminismCheckSampling(t *testing.T) {
+	reported := make(chan error, 1)
+	e := &Entity{
+		ServiceName:   "counter",
+		SnapshotEvery: 100,
+		EntityFunc: func(EntityID) EntityHandler {
+			return &counter{nonDeterministic: true}
+		},
+		DeterminismCheck: &DeterminismCheck{
+			SampleRate: 1,
+			Rand:       rand.New(rand.NewSource(1)),
+			Report: func(id EntityID, err error) {
+				reported <- err
+			},
+		},
+	}
+	server := NewServer()
+	if err := server.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	r := &runner{stream: TestEventSourcedHandleServer{}}
+	err := server.handleInit(&entity.EventSourcedInit{ServiceName: "counter", EntityId: "c-1"}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.recovery == nil {
+		t.Fatal("r.recovery = nil; want the recovery to be recorded")
+	}
+	for i, payload := range increments(t, 3) {
+		event := &entity.EventSourcedEvent{Sequence: int64(i + 1), Payload: payload}
+		if err := r.handleEvent(event); err != nil {
+			t.Fatal(err)
+		}
+		r.recordEvent(event)
+	}
+	r.verifyRecovery()
+	if r.recovery != nil {
+		t.Fatal("r.recovery should be reset after verification")
+	}
+	select {
+	case err := <-reported:
+		if !errors.Is(err, ErrNonDeterministic) {
+			t.Fatalf("reported = %v; want: %v", err, ErrNonDeterministic)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no failed verification reported")
+	}
+}
+
+func TestDeterminismCheckBounds(t *testing.T) {
+	t.Run("sampling requires a Rand", func(t *testing.T) {
+		err := NewServer().Register(&Entity{
+			ServiceName: "counter",
+			EntityFunc: func(EntityID) EntityHandler {
+				return &counter{}
+			},
+			DeterminismCheck: &DeterminismCheck{SampleRate: 1},
+		})
+		if err == nil {
+			t.Fatal("err = nil; want an error for a DeterminismCheck without Rand")
+		}
+	})
+	t.Run("recoveries with more than MaxEvents are not verified", func(t *testing.T) {
+		e := &Entity{
+			ServiceName: "counter",
+			EntityFunc: func(EntityID) EntityHandler {
+				return &counter{}
+			},
+			DeterminismCheck: &DeterminismCheck{
+				SampleRate: 1,
+				Rand:       rand.New(rand.NewSource(1)),
+				MaxEvents:  2,
+			},
+		}
+		server := NewServer()
+		if err := server.Register(e); err != nil {
+			t.Fatal(err)
+		}
+		r := &runner{stream: TestEventSourcedHandleServer{}}
+		err := server.handleInit(&entity.EventSourcedInit{ServiceName: "counter", EntityId: "c-1"}, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, payload := range increments(t, 3) {
+			r.recordEvent(&entity.EventSourcedEvent{Sequence: int64(i + 1), Payload: payload})
+		}
+		if r.recovery != nil {
+			t.Fatalf("len(r.recovery.events) = %d; want the recovery to be dropped", len(r.recovery.events))
+		}
+	})
+}
@@ -16,6 +16,8 @@
 package eventsourced
 
 import (
+	"time"
+
 	"github.com/golang/protobuf/proto"
 )
 
@@ -40,6 +42,22 @@ type Entity struct {
 	SnapshotEvery int64
 	// EntityFunc is a factory method which generates a new Entity.
 	EntityFunc func(id EntityID) EntityHandler
+	// DeterminismCheck, if set, verifies a sample of recovered entities to
+	// have handled their snapshot and events deterministically.
+	// Verification creates additional entity instances using EntityFunc
+	// and runs off the stream of the entity.
+	DeterminismCheck *DeterminismCheck
+	// EventPublisher, if set, publishes emitted events to an eventing
+	// destination.
+	EventPublisher *EventPublisher
+	// CommandTimeout, if set, limits the time a command handler may take.
+	// The context returned by Context.StreamCtx has the deadline of the
+	// command while it is handled. If a handler does not return in time, a
+	// client failure is sent, the entity is restarted and the timeout is
+	// counted by the metrics package. The handler is not stopped though and
+	// keeps running in its goroutine, possibly still mutating the entity
+	// instance. Handlers should therefore return once the context is done.
+	CommandTimeout time.Duration
 }
 
 type (
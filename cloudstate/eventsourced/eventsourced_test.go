@@ -17,11 +17,13 @@ package eventsourced
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"testing"
 
 	"github.com/cloudstateio/go-support/cloudstate/encoding"
 	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes/empty"
 	"google.golang.org/grpc"
@@ -240,3 +242,87 @@ func TestSnapshot(t *testing.T) {
 		t.Fatalf("testEntity.Value should be 0 but was not: %+v", testEntity)
 	}
 }
+
+// recordingHandleServer records messages sent.
+type recordingHandleServer struct {
+	TestEventSourcedHandleServer
+	sent []*entity.EventSourcedStreamOut
+}
+
+func (t *recordingHandleServer) Send(out *entity.EventSourcedStreamOut) error {
+	t.sent = append(t.sent, out)
+	return nil
+}
+
+// metadataEntity replies with the metadata of a command and forwards
+// commands named "Forward".
+type metadataEntity struct{}
+
+func (metadataEntity) HandleCommand(ctx *Context, name string, _ proto.Message) (proto.Message, error) {
+	ctx.SetReplyMetadata(&protocol.Metadata{Entries: append(ctx.Metadata().GetEntries(),
+		&protocol.MetadataEntry{Key: "command", Value: &protocol.MetadataEntry_StringValue{
+			StringValue: fmt.Sprintf("%s-%d", ctx.CommandName(), ctx.CommandID()),
+		}},
+	)})
+	if name == "Forward" {
+		ctx.Forward(&protocol.Forward{
+			ServiceName: "other",
+			CommandName: "Other",
+			Metadata: &protocol.Metadata{Entries: []*protocol.MetadataEntry{
+				{Key: "command", Value: &protocol.MetadataEntry_StringValue{StringValue: "forwarded"}},
+			}},
+		})
+	}
+	return &empty.Empty{}, nil
+}
+
+func (metadataEntity) HandleEvent(*Context, interface{}) error {
+	return nil
+}
+
+func TestCommandMetadata(t *testing.T) {
+	stream := &recordingHandleServer{}
+	r := &runner{
+		stream: stream,
+		context: &Context{
+			EntityID:           "entity-0",
+			EventSourcedEntity: &Entity{},
+			Instance:           metadataEntity{},
+			ctx:                context.Background(),
+		},
+	}
+	payload, err := encoding.MarshalAny(&IncrementByCommand{Amount: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := &protocol.Metadata{Entries: []*protocol.MetadataEntry{
+		{Key: "header", Value: &protocol.MetadataEntry_StringValue{StringValue: "value"}},
+	}}
+	for _, name := range []string{"Reply", "Forward"} {
+		if err := r.handleCommand(&protocol.Command{Id: 7, Name: name, Payload: payload, Metadata: md}); err != nil {
+			t.Fatal(err)
+		}
+		r.context.reset()
+		if r.context.Command() != nil {
+			t.Fatal("the context should not return a command after reset")
+		}
+	}
+	reply := stream.sent[0].GetReply().GetClientAction().GetReply()
+	if got, want := len(reply.GetMetadata().GetEntries()), 2; got != want {
+		t.Fatalf("len(reply.Metadata.Entries) = %d; want: %d", got, want)
+	}
+	if got, want := reply.GetMetadata().GetEntries()[1].GetStringValue(), "Reply-7"; got != want {
+		t.Fatalf("reply.Metadata.Entries[1] = %q; want: %q", got, want)
+	}
+	forward := stream.sent[1].GetReply().GetClientAction().GetForward()
+	entries := forward.GetMetadata().GetEntries()
+	if got, want := len(entries), 2; got != want {
+		t.Fatalf("len(forward.Metadata.Entries) = %d; want: %d", got, want)
+	}
+	if got, want := entries[0].GetStringValue(), "forwarded"; got != want {
+		t.Fatalf("forward.Metadata.Entries[0] = %q; want: %q", got, want)
+	}
+	if got, want := entries[1].GetKey(), "header"; got != want {
+		t.Fatalf("forward.Metadata.Entries[1].Key = %q; want: %q", got, want)
+	}
+}
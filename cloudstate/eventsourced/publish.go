@@ -0,0 +1,133 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventsourced
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudstateio/go-support/cloudstate/cloudevents"
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// A PublishFunc transforms an emitted event into the message to be published.
+// Returning a nil message skips publishing the event.
+type PublishFunc func(ctx *Context, event interface{}) (message interface{}, err error)
+
+// EventPublisher publishes the events emitted by an entity through a service
+// method having an EventDestination declared in its cloudstate.eventing
+// options. Each event is published by a side effect calling the method with
+// CloudEvent metadata attached. The ce-type is the type of the published
+// message and the ce-id is derived from the persistence id, the entity id and
+// the event sequence, so that an event published again after a restart of the
+// entity keeps its id. Events emitted by a failed command are not
+// published. If publishing fails, the command fails with a server error and
+// the entity is restarted, as its events have already been applied.
+type EventPublisher struct {
+	// ServiceName is the service of the method events are published through.
+	// It defaults to the service name of the entity.
+	ServiceName ServiceName
+	// CommandName is the name of the method events are published through.
+	// Setting it is mandatory.
+	CommandName string
+	// Source is the CloudEvent source of published events. It defaults to
+	// the service name of the entity.
+	Source string
+	// Events selects the events to be published by their type, the message
+	// name for protobuf events, like "com.example.ItemAdded". A nil PublishFunc
+	// publishes an event as emitted. Events of types not listed are not
+	// published. If Events is nil, all events are published as emitted.
+	Events map[string]PublishFunc
+	// Synchronous sets published events to be side effects run synchronously.
+	Synchronous bool
+}
+
+// publishEvents adds a side effect for each event emitted that is to be
+// published.
+func (c *Context) publishEvents() error {
+	p := c.EventSourcedEntity.EventPublisher
+	if p == nil {
+		return nil
+	}
+	first := c.eventSequence - int64(len(c.events)) + 1
+	for i, event := range c.events {
+		payload, err := marshalEvent(event)
+		if err != nil {
+			return err
+		}
+		eventType := typeName(payload)
+		if p.Events != nil {
+			publish, ok := p.Events[eventType]
+			if !ok {
+				continue
+			}
+			if publish != nil {
+				message, err := publish(c, event)
+				if err != nil {
+					return fmt.Errorf("publishing of event %q failed: %w", eventType, err)
+				}
+				if message == nil {
+					continue
+				}
+				if payload, err = marshalEvent(message); err != nil {
+					return err
+				}
+			}
+		}
+		ce := cloudevents.New(
+			fmt.Sprintf("%s-%s-%d", c.EventSourcedEntity.PersistenceID, c.EntityID, first+int64(i)),
+			p.source(c.EventSourcedEntity),
+			typeName(payload),
+		)
+		ce.Subject = string(c.EntityID)
+		c.Effect(&protocol.SideEffect{
+			ServiceName: p.serviceName(c.EventSourcedEntity).String(),
+			CommandName: p.CommandName,
+			Payload:     payload,
+			Synchronous: p.Synchronous,
+			Metadata:    ce.Metadata(nil),
+		})
+	}
+	return nil
+}
+
+func (p *EventPublisher) serviceName(e *Entity) ServiceName {
+	if p.ServiceName != "" {
+		return p.ServiceName
+	}
+	return e.ServiceName
+}
+
+func (p *EventPublisher) source(e *Entity) string {
+	if p.Source != "" {
+		return p.Source
+	}
+	return e.ServiceName.String()
+}
+
+// typeName returns the type name of a payload, the last segment of its type URL.
+func typeName(payload *any.Any) string {
+	return payload.GetTypeUrl()[strings.LastIndex(payload.GetTypeUrl(), "/")+1:]
+}
+
+func marshalEvent(event interface{}) (*any.Any, error) {
+	if e, ok := event.(*any.Any); ok {
+		return e, nil
+	}
+	return encoding.DefaultRegistry.Encode(event)
+}
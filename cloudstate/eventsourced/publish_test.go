@@ -0,0 +1,149 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventsourced
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/cloudevents"
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/empty"
+)
+
+// emitter emits an increment and a decrement event for every command.
+type emitter struct{}
+
+func (emitter) HandleCommand(ctx *Context, _ string, _ proto.Message) (proto.Message, error) {
+	ctx.Emit(&IncrementByEvent{Value: 3})
+	ctx.Emit(&DecrementByEvent{Value: 2})
+	return &empty.Empty{}, nil
+}
+
+func (emitter) HandleEvent(*Context, interface{}) error {
+	return nil
+}
+
+func metadataValue(md *protocol.Metadata, key string) string {
+	for _, e := range md.GetEntries() {
+		if e.GetKey() == key {
+			return e.GetStringValue()
+		}
+	}
+	return ""
+}
+
+func TestEventPublisher(t *testing.T) {
+	newRunner := func(p *EventPublisher) (*runner, *recordingHandleServer) {
+		stream := &recordingHandleServer{}
+		return &runner{
+			stream: stream,
+			context: &Context{
+				EntityID:           "entity-0",
+				EventSourcedEntity: &Entity{ServiceName: "com.example.Counter", PersistenceID: "counter", EventPublisher: p},
+				Instance:           emitter{},
+				eventSequence:      10,
+				ctx:                context.Background(),
+			},
+		}, stream
+	}
+	payload, err := encoding.MarshalAny(&IncrementByCommand{Amount: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := &protocol.Command{Id: 1, Name: "Emit", Payload: payload}
+
+	t.Run("all events are published with CloudEvent metadata", func(t *testing.T) {
+		r, stream := newRunner(&EventPublisher{CommandName: "Publish"})
+		if err := r.handleCommand(cmd); err != nil {
+			t.Fatal(err)
+		}
+		effects := stream.sent[0].GetReply().GetSideEffects()
+		if got, want := len(effects), 2; got != want {
+			t.Fatalf("len(effects) = %d; want: %d", got, want)
+		}
+		effect := effects[1]
+		if got, want := effect.GetServiceName(), "com.example.Counter"; got != want {
+			t.Fatalf("effect.ServiceName = %q; want: %q", got, want)
+		}
+		if got, want := effect.GetCommandName(), "Publish"; got != want {
+			t.Fatalf("effect.CommandName = %q; want: %q", got, want)
+		}
+		for key, want := range map[string]string{
+			cloudevents.SpecVersionKey: "1.0",
+			cloudevents.TypeKey:        "DecrementByEvent",
+			cloudevents.SourceKey:      "com.example.Counter",
+			cloudevents.SubjectKey:     "entity-0",
+		} {
+			if got := metadataValue(effect.GetMetadata(), key); got != want {
+				t.Fatalf("metadata %q = %q; want: %q", key, got, want)
+			}
+		}
+		id := metadataValue(effect.GetMetadata(), cloudevents.IDKey)
+		if want := "counter-entity-0-12"; id != want {
+			t.Fatalf("ce-id = %q; want: %q", id, want)
+		}
+	})
+
+	t.Run("events are selected and transformed by type", func(t *testing.T) {
+		r, stream := newRunner(&EventPublisher{
+			CommandName: "Publish",
+			Events: map[string]PublishFunc{
+				"IncrementByEvent": func(_ *Context, event interface{}) (interface{}, error) {
+					return &IncrementByCommand{Amount: event.(*IncrementByEvent).Value}, nil
+				},
+			},
+		})
+		if err := r.handleCommand(cmd); err != nil {
+			t.Fatal(err)
+		}
+		effects := stream.sent[0].GetReply().GetSideEffects()
+		if got, want := len(effects), 1; got != want {
+			t.Fatalf("len(effects) = %d; want: %d", got, want)
+		}
+		published := &IncrementByCommand{}
+		if err := encoding.UnmarshalAny(effects[0].GetPayload(), published); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := published.Amount, int64(3); got != want {
+			t.Fatalf("published.Amount = %d; want: %d", got, want)
+		}
+		if got, want := metadataValue(effects[0].GetMetadata(), cloudevents.TypeKey), "IncrementByCommand"; got != want {
+			t.Fatalf("ce-type = %q; want: %q", got, want)
+		}
+	})
+
+	t.Run("a failing PublishFunc fails the entity", func(t *testing.T) {
+		r, stream := newRunner(&EventPublisher{
+			CommandName: "Publish",
+			Events: map[string]PublishFunc{
+				"IncrementByEvent": func(*Context, interface{}) (interface{}, error) {
+					return nil, errors.New("boom")
+				},
+			},
+		})
+		err := r.handleCommand(cmd)
+		if !errors.As(err, &protocol.ServerError{}) {
+			t.Fatalf("err = %v; want a protocol.ServerError", err)
+		}
+		if len(stream.sent) > 0 {
+			t.Fatal("no reply should have been sent")
+		}
+	})
+}
@@ -16,14 +16,14 @@
 package eventsourced
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"net/url"
-	"reflect"
-	"strings"
 
 	"github.com/cloudstateio/go-support/cloudstate/encoding"
 	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/internal/timeout"
+	"github.com/cloudstateio/go-support/cloudstate/metrics"
 	"github.com/cloudstateio/go-support/cloudstate/protocol"
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes/any"
@@ -33,27 +33,43 @@ import (
 type runner struct {
 	stream  entity.EventSourced_HandleServer
 	context *Context
+	// recovery is set if the recovery of the entity is to be verified
+	// by a DeterminismCheck.
+	recovery *recovery
 }
 
 // handleCommand handles a command received from the Cloudstate proxy.
 func (r *runner) handleCommand(cmd *protocol.Command) error {
-	msgName := strings.TrimPrefix(cmd.Payload.GetTypeUrl(), encoding.ProtoAnyBase+"/")
-	msgType := proto.MessageType(msgName)
-	if msgType.Kind() != reflect.Ptr {
-		return fmt.Errorf("msgType: %s is of non Ptr kind", msgType)
+	r.context.command = cmd
+	message, err := encoding.DefaultRegistry.DecodeMessage(cmd.GetPayload())
+	if err != nil {
+		return err
 	}
-	// Get a zero-ed message of this type.
-	message, ok := reflect.New(msgType.Elem()).Interface().(proto.Message)
-	if !ok {
-		return fmt.Errorf("msgType is no proto.Message: %v", msgType)
+	// The gRPC implementation returns the service method return and an error as a second return value.
+	var cmdReply proto.Message
+	var errReturned error
+	streamCtx := r.context.ctx
+	err = timeout.Run(streamCtx, r.context.EventSourcedEntity.CommandTimeout, func(ctx context.Context) {
+		r.context.ctx = ctx
+		cmdReply, errReturned = r.context.Instance.HandleCommand(r.context, cmd.Name, message)
+	})
+	if err == context.DeadlineExceeded {
+		// The handler still runs and might change the entity further, which
+		// therefore gets restarted.
+		metrics.CommandTimedOut(r.context.EventSourcedEntity.ServiceName.String())
+		if err := r.sendClientActionFailure(&protocol.Failure{
+			CommandId:   cmd.Id,
+			Description: timeout.ErrCommandTimeout.Error(),
+			Restart:     true,
+		}); err != nil {
+			return err
+		}
+		return timeout.ErrCommandTimeout
 	}
-	// Unmarshal the payload onto the zero-ed message.
-	err := proto.Unmarshal(cmd.Payload.Value, message)
 	if err != nil {
-		return fmt.Errorf("%s, %w", err, encoding.ErrMarshal)
+		return err
 	}
-	// The gRPC implementation returns the service method return and an error as a second return value.
-	cmdReply, errReturned := r.context.Instance.HandleCommand(r.context, cmd.Name, message)
+	r.context.ctx = streamCtx
 	// We the take error returned as a client failure except if it's a protocol.ServerError.
 	if errReturned != nil {
 		// If the error is a ServerError, we return this error and the stream will end.
@@ -71,8 +87,15 @@ func (r *runner) handleCommand(cmd *protocol.Command) error {
 	if r.context.failed != nil {
 		return r.context.failed
 	}
+	// Publish the events emitted.
+	if err := r.context.publishEvents(); err != nil {
+		return protocol.ServerError{
+			Failure: &protocol.Failure{CommandId: cmd.GetId()},
+			Err:     fmt.Errorf("publishing of events failed: %w", err),
+		}
+	}
 	// Get the reply.
-	reply, err := encoding.MarshalAny(cmdReply)
+	reply, err := encoding.DefaultRegistry.Encode(cmdReply)
 	if err != nil { // this should never happen
 		return protocol.ServerError{
 			Failure: &protocol.Failure{CommandId: cmd.GetId()},
@@ -104,7 +127,7 @@ func (r *runner) handleCommand(cmd *protocol.Command) error {
 			CommandId: cmd.GetId(),
 			ClientAction: &protocol.ClientAction{
 				Action: &protocol.ClientAction_Forward{
-					Forward: r.context.forward,
+					Forward: r.context.forwardWithMetadata(),
 				},
 			},
 			Events:      events,
@@ -117,7 +140,8 @@ func (r *runner) handleCommand(cmd *protocol.Command) error {
 		ClientAction: &protocol.ClientAction{
 			Action: &protocol.ClientAction_Reply{
 				Reply: &protocol.Reply{
-					Payload: reply,
+					Payload:  reply,
+					Metadata: r.context.replyMetadataFor(cmd),
 				},
 			},
 		},
@@ -156,8 +180,7 @@ func (r *runner) handleSnapshot() (*any.Any, error) {
 	if err != nil {
 		return nil, fmt.Errorf("getting a snapshot has failed: %w", err)
 	}
-	// TODO: we expect a proto.Message but can support other format.
-	snapshot, err := encoding.MarshalAny(s)
+	snapshot, err := encoding.DefaultRegistry.Encode(s)
 	if err != nil {
 		return nil, err
 	}
@@ -166,22 +189,10 @@ func (r *runner) handleSnapshot() (*any.Any, error) {
 }
 
 func (r *runner) handleEvent(event *entity.EventSourcedEvent) error {
-	// TODO: here's the point where events can be protobufs, serialized as json or other formats
-	msgName := strings.TrimPrefix(event.Payload.GetTypeUrl(), encoding.ProtoAnyBase+"/")
-	msgType := proto.MessageType(msgName)
-	if msgType.Kind() != reflect.Ptr {
-		return fmt.Errorf("msgType.Kind() is not a pointer type: %v", msgType)
-	}
-	// Get a zero-ed message of this type.
-	message, ok := reflect.New(msgType.Elem()).Interface().(proto.Message)
-	if !ok {
-		return fmt.Errorf("unable to create a new zero-ed message of type: %v", msgType)
-	}
-	// Marshal what we got as an any.Any onto it.
-	if err := proto.Unmarshal(event.Payload.Value, message); err != nil {
-		return fmt.Errorf("%s: %w", err, encoding.ErrMarshal)
+	message, err := encoding.DefaultRegistry.Decode(event.GetPayload())
+	if err != nil {
+		return err
 	}
-	// We're ready to handle the proto message.
 	if err := r.context.Instance.HandleEvent(r.context, message); err != nil {
 		return err
 	}
@@ -191,7 +202,7 @@ func (r *runner) handleEvent(event *entity.EventSourcedEvent) error {
 
 // applyEvent applies an event to a local entity.
 func (r *runner) applyEvent(event interface{}) error {
-	payload, err := encoding.MarshalAny(event)
+	payload, err := marshalEvent(event)
 	if err != nil {
 		return err
 	}
@@ -199,35 +210,7 @@ func (r *runner) applyEvent(event interface{}) error {
 }
 
 func (*runner) unmarshalSnapshot(snapshot *entity.EventSourcedSnapshot) (interface{}, error) {
-	// see: https://developers.google.com/protocol-buffers/docs/reference/csharp/class/google/protobuf/well-known-types/any#typeurl
-	typeURL := snapshot.Snapshot.GetTypeUrl()
-	if !strings.Contains(typeURL, "://") {
-		typeURL = "https://" + typeURL
-	}
-	parsedURL, err := url.Parse(typeURL)
-	if err != nil {
-		return nil, err
-	}
-	switch parsedURL.Host {
-	case encoding.PrimitiveTypeURLPrefix:
-		return encoding.UnmarshalPrimitive(snapshot.Snapshot)
-	case encoding.ProtoAnyBase:
-		// TODO: this might be something else than a proto message
-		msgName := strings.TrimPrefix(snapshot.Snapshot.GetTypeUrl(), encoding.ProtoAnyBase+"/")
-		msgType := proto.MessageType(msgName)
-		if msgType.Kind() != reflect.Ptr {
-			return nil, err
-		}
-		message, ok := reflect.New(msgType.Elem()).Interface().(proto.Message)
-		if !ok {
-			return nil, err
-		}
-		if err := proto.Unmarshal(snapshot.Snapshot.Value, message); err != nil {
-			return nil, err
-		}
-		return message, nil
-	}
-	return nil, fmt.Errorf("no snapshot unmarshaller found for: %q", parsedURL.String())
+	return encoding.DefaultRegistry.Decode(snapshot.GetSnapshot())
 }
 
 func (r *runner) sendEventSourcedReply(reply *entity.EventSourcedReply) error {
@@ -23,6 +23,7 @@ import (
 	"sync"
 
 	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/internal/timeout"
 	"github.com/cloudstateio/go-support/cloudstate/protocol"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -52,6 +53,12 @@ func (s *Server) Register(entity *Entity) error {
 	if entity.EntityFunc == nil {
 		return errors.New("the entity has to define an EntityFunc but did not")
 	}
+	if dc := entity.DeterminismCheck; dc != nil && dc.SampleRate > 0 && dc.Rand == nil {
+		return errors.New("the entity determinism check has to define a Rand to sample recoveries but did not")
+	}
+	if entity.EventPublisher != nil && entity.EventPublisher.CommandName == "" {
+		return errors.New("the entity event publisher has to define a CommandName but did not")
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, exists := s.entities[entity.ServiceName]; exists {
@@ -141,7 +148,14 @@ func (s *Server) handle(stream entity.EventSourced_HandleServer) error {
 		}
 		switch m := msg.GetMessage().(type) {
 		case *entity.EventSourcedStreamIn_Command:
+			if r.recovery != nil {
+				r.verifyRecovery()
+			}
 			err := r.handleCommand(m.Command)
+			if err == timeout.ErrCommandTimeout {
+				// The entity is restarted by the proxy.
+				return nil
+			}
 			r.context.reset()
 			if err == nil {
 				continue
@@ -157,6 +171,7 @@ func (s *Server) handle(stream entity.EventSourced_HandleServer) error {
 			if err := r.handleEvent(m.Event); err != nil {
 				return err
 			}
+			r.recordEvent(m.Event)
 		case *entity.EventSourcedStreamIn_Init:
 			return errors.New("duplicate init message for the same entity")
 		case nil:
@@ -187,6 +202,9 @@ func (s *Server) handleInit(init *entity.EventSourcedInit, r *runner) error {
 		eventSequence:      0,
 		ctx:                r.stream.Context(),
 	}
+	if e.DeterminismCheck.sampled() {
+		r.recovery = &recovery{snapshot: init.GetSnapshot()}
+	}
 	if snapshot := init.GetSnapshot(); snapshot != nil {
 		if err := r.handleInitSnapshot(snapshot); err != nil {
 			return err
@@ -0,0 +1,140 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testkit
+
+import (
+	"sync"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/eventsourced"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// Journal is an in-memory event journal and snapshot store, the part of
+// the Cloudstate proxy an event sourced entity gets recovered from.
+type Journal struct {
+	// mu protects the maps below.
+	mu        sync.RWMutex
+	events    map[eventsourced.EntityID][]*entity.EventSourcedEvent
+	snapshots map[eventsourced.EntityID]*entity.EventSourcedSnapshot
+}
+
+func newJournal() *Journal {
+	return &Journal{
+		events:    make(map[eventsourced.EntityID][]*entity.EventSourcedEvent),
+		snapshots: make(map[eventsourced.EntityID]*entity.EventSourcedSnapshot),
+	}
+}
+
+// Append appends events to the journal of the entity with the given id.
+// Events not already of type *any.Any are marshalled as protobuf messages.
+func (j *Journal) Append(id eventsourced.EntityID, events ...interface{}) error {
+	payloads := make([]*any.Any, len(events))
+	for i, evt := range events {
+		payload, err := marshalAny(evt)
+		if err != nil {
+			return err
+		}
+		payloads[i] = payload
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.append(id, payloads)
+	return nil
+}
+
+// SaveSnapshot stores a snapshot for the entity with the given id at its
+// current journal sequence.
+func (j *Journal) SaveSnapshot(id eventsourced.EntityID, snapshot interface{}) error {
+	payload, err := marshalAny(snapshot)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.snapshots[id] = &entity.EventSourcedSnapshot{
+		SnapshotSequence: j.sequence(id),
+		Snapshot:         payload,
+	}
+	return nil
+}
+
+// Events returns all events journaled for the entity with the given id.
+func (j *Journal) Events(id eventsourced.EntityID) []*entity.EventSourcedEvent {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return append(make([]*entity.EventSourcedEvent, 0, len(j.events[id])), j.events[id]...)
+}
+
+// Snapshot returns the latest snapshot stored for the entity with the given
+// id, or nil if there is none.
+func (j *Journal) Snapshot(id eventsourced.EntityID) *entity.EventSourcedSnapshot {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.snapshots[id]
+}
+
+// Sequence returns the sequence number of the last event journaled for the
+// entity with the given id.
+func (j *Journal) Sequence(id eventsourced.EntityID) int64 {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.sequence(id)
+}
+
+// persist stores events and an optional snapshot taken after them, as the
+// proxy does for an event sourced reply.
+func (j *Journal) persist(id eventsourced.EntityID, events []*any.Any, snapshot *any.Any) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.append(id, events)
+	if snapshot != nil {
+		j.snapshots[id] = &entity.EventSourcedSnapshot{
+			SnapshotSequence: j.sequence(id),
+			Snapshot:         snapshot,
+		}
+	}
+}
+
+func (j *Journal) append(id eventsourced.EntityID, events []*any.Any) {
+	seq := j.sequence(id)
+	for _, e := range events {
+		seq++
+		j.events[id] = append(j.events[id], &entity.EventSourcedEvent{
+			Sequence: seq,
+			Payload:  e,
+		})
+	}
+}
+
+func (j *Journal) sequence(id eventsourced.EntityID) int64 {
+	events := j.events[id]
+	if len(events) == 0 {
+		if s := j.snapshots[id]; s != nil {
+			return s.SnapshotSequence
+		}
+		return 0
+	}
+	return events[len(events)-1].Sequence
+}
+
+func marshalAny(i interface{}) (*any.Any, error) {
+	if a, ok := i.(*any.Any); ok {
+		return a, nil
+	}
+	return encoding.MarshalAny(i)
+}
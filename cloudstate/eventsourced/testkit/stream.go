@@ -0,0 +1,39 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testkit
+
+import (
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/internal/teststream"
+)
+
+// stream is the entity.EventSourced_HandleServer of a connection to the
+// stream handler of an eventsourced.Server.
+type stream struct {
+	*teststream.ServerStream
+}
+
+func (s stream) Send(out *entity.EventSourcedStreamOut) error {
+	return s.ServerStream.Send(out)
+}
+
+func (s stream) Recv() (*entity.EventSourcedStreamIn, error) {
+	in, err := s.ServerStream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return in.(*entity.EventSourcedStreamIn), nil
+}
@@ -0,0 +1,233 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testkit drives an eventsourced.Entity in-memory, without a
+// Cloudstate proxy and without gRPC.
+//
+// A TestKit keeps a Journal of the events and snapshots an entity persisted.
+// Commands are sent to an Instance of the entity, which is loaded from the
+// journal the same way the proxy would recover it.
+package testkit
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/eventsourced"
+	"github.com/cloudstateio/go-support/cloudstate/internal/teststream"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// ErrPassivated is returned for commands sent to a passivated instance.
+var ErrPassivated = teststream.ErrPassivated
+
+// TestKit runs an event sourced entity against an in-memory journal.
+type TestKit struct {
+	entity  *eventsourced.Entity
+	server  *eventsourced.Server
+	journal *Journal
+}
+
+// New returns a TestKit for the given entity. The entity gets registered
+// the same way a CloudState instance does, which includes defaulting
+// SnapshotEvery.
+func New(e *eventsourced.Entity) (*TestKit, error) {
+	server := eventsourced.NewServer()
+	if err := server.Register(e); err != nil {
+		return nil, err
+	}
+	return &TestKit{
+		entity:  e,
+		server:  server,
+		journal: newJournal(),
+	}, nil
+}
+
+// Journal returns the journal of the test kit.
+func (tk *TestKit) Journal() *Journal {
+	return tk.journal
+}
+
+// Load starts an instance of the entity with the given id and recovers it
+// from its latest snapshot plus the events journaled after it.
+func (tk *TestKit) Load(id eventsourced.EntityID) (*Instance, error) {
+	snapshot := tk.journal.Snapshot(id)
+	var events []*entity.EventSourcedEvent
+	for _, e := range tk.journal.Events(id) {
+		if snapshot == nil || e.Sequence > snapshot.SnapshotSequence {
+			events = append(events, e)
+		}
+	}
+	return tk.start(id, snapshot, events)
+}
+
+// Replay starts an instance of the entity with the given id and recovers it
+// from all of its journaled events, ignoring any snapshot.
+func (tk *TestKit) Replay(id eventsourced.EntityID) (*Instance, error) {
+	return tk.start(id, nil, tk.journal.Events(id))
+}
+
+// CheckDeterminism checks that the events journaled for the entity with the
+// given id are handled deterministically. See eventsourced.CheckDeterminism.
+func (tk *TestKit) CheckDeterminism(id eventsourced.EntityID) error {
+	events := tk.journal.Events(id)
+	payloads := make([]*any.Any, len(events))
+	for i, e := range events {
+		payloads[i] = e.Payload
+	}
+	return eventsourced.CheckDeterminism(tk.entity, id, payloads)
+}
+
+func (tk *TestKit) start(id eventsourced.EntityID, snapshot *entity.EventSourcedSnapshot, events []*entity.EventSourcedEvent) (*Instance, error) {
+	i := &Instance{
+		id: id,
+		tk: tk,
+		conn: teststream.Open(func(s *teststream.ServerStream) error {
+			return tk.server.Handle(stream{s})
+		}),
+	}
+	if err := i.conn.Send(&entity.EventSourcedStreamIn{
+		Message: &entity.EventSourcedStreamIn_Init{
+			Init: &entity.EventSourcedInit{
+				ServiceName: tk.entity.ServiceName.String(),
+				EntityId:    string(id),
+				Snapshot:    snapshot,
+			},
+		},
+	}); err != nil {
+		i.conn.Close()
+		return nil, err
+	}
+	for _, e := range events {
+		if err := i.conn.Send(&entity.EventSourcedStreamIn{
+			Message: &entity.EventSourcedStreamIn_Event{Event: e},
+		}); err != nil {
+			i.conn.Close()
+			return nil, err
+		}
+	}
+	return i, nil
+}
+
+// Instance is a running instance of an event sourced entity.
+// Recovery failures are reported by the first command sent to it.
+type Instance struct {
+	id        eventsourced.EntityID
+	tk        *TestKit
+	conn      *teststream.Conn
+	commandID int64
+}
+
+// Command sends a command to the entity instance and returns its result.
+// Events emitted and snapshots taken are persisted to the journal unless
+// the command failed. An error is returned if the entity failed the stream,
+// after which the instance is not usable anymore.
+func (i *Instance) Command(name string, cmd proto.Message) (*Result, error) {
+	payload, err := encoding.MarshalAny(cmd)
+	if err != nil {
+		return nil, err
+	}
+	i.commandID++
+	if err := i.conn.Send(&entity.EventSourcedStreamIn{
+		Message: &entity.EventSourcedStreamIn_Command{
+			Command: &protocol.Command{
+				EntityId: string(i.id),
+				Id:       i.commandID,
+				Name:     name,
+				Payload:  payload,
+			},
+		},
+	}); err != nil {
+		return nil, err
+	}
+	out, err := i.conn.Recv()
+	if err != nil {
+		return nil, err
+	}
+	switch m := out.(*entity.EventSourcedStreamOut).GetMessage().(type) {
+	case *entity.EventSourcedStreamOut_Reply:
+		r := resultFor(m.Reply)
+		if r.Failure == nil {
+			i.tk.journal.persist(i.id, r.Events, r.Snapshot)
+		}
+		return r, nil
+	case *entity.EventSourcedStreamOut_Failure:
+		return nil, i.conn.Fail(m.Failure)
+	default:
+		return nil, fmt.Errorf("unexpected message received: %+v", m)
+	}
+}
+
+// Passivate closes the stream of the instance, as the proxy does when
+// the entity gets passivated, and waits for the entity to stop.
+func (i *Instance) Passivate() error {
+	return i.conn.Passivate()
+}
+
+// Result is the outcome of a command handled by an entity instance.
+type Result struct {
+	// Reply is the reply payload, if the command was replied to.
+	Reply *any.Any
+	// Metadata is the reply metadata, if the command was replied to.
+	Metadata *protocol.Metadata
+	// Forward is set if the command was forwarded.
+	Forward *protocol.Forward
+	// Failure is set if the command failed.
+	Failure *protocol.Failure
+	// Events are the events emitted by the command handler.
+	Events []*any.Any
+	// Snapshot is set if a snapshot was taken.
+	Snapshot *any.Any
+	// SideEffects are the side effects emitted by the command handler.
+	SideEffects []*protocol.SideEffect
+}
+
+func resultFor(reply *entity.EventSourcedReply) *Result {
+	r := &Result{
+		Events:      reply.GetEvents(),
+		Snapshot:    reply.GetSnapshot(),
+		SideEffects: reply.GetSideEffects(),
+	}
+	switch a := reply.GetClientAction().GetAction().(type) {
+	case *protocol.ClientAction_Reply:
+		r.Reply = a.Reply.GetPayload()
+		r.Metadata = a.Reply.GetMetadata()
+	case *protocol.ClientAction_Forward:
+		r.Forward = a.Forward
+	case *protocol.ClientAction_Failure:
+		r.Failure = a.Failure
+	}
+	return r
+}
+
+// UnmarshalReply unmarshals the reply payload into p.
+func (r *Result) UnmarshalReply(p proto.Message) error {
+	if r.Reply == nil {
+		return errors.New("the command was not replied to")
+	}
+	return encoding.UnmarshalAny(r.Reply, p)
+}
+
+// UnmarshalEvent unmarshals the i-th emitted event into p.
+func (r *Result) UnmarshalEvent(i int, p proto.Message) error {
+	if i >= len(r.Events) {
+		return fmt.Errorf("no event at index %d, %d events were emitted", i, len(r.Events))
+	}
+	return encoding.UnmarshalAny(r.Events[i], p)
+}
@@ -0,0 +1,242 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testkit
+
+import (
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/eventsourced"
+	"github.com/cloudstateio/go-support/example/shoppingcart"
+	domain "github.com/cloudstateio/go-support/example/shoppingcart/persistence"
+)
+
+func newTestKit(t *testing.T, snapshotEvery int64) *TestKit {
+	t.Helper()
+	tk, err := New(&eventsourced.Entity{
+		ServiceName:   "com.example.shoppingcart.ShoppingCart",
+		PersistenceID: "ShoppingCart",
+		SnapshotEvery: snapshotEvery,
+		EntityFunc:    shoppingcart.NewShoppingCart,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tk
+}
+
+func addItem(t *testing.T, i *Instance, productID string, quantity int32) *Result {
+	t.Helper()
+	r, err := i.Command("AddItem", &shoppingcart.AddLineItem{
+		UserId: "user1", ProductId: productID, Name: productID, Quantity: quantity,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func getCart(t *testing.T, i *Instance) *shoppingcart.Cart {
+	t.Helper()
+	r, err := i.Command("GetCart", &shoppingcart.GetShoppingCart{UserId: "user1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cart := &shoppingcart.Cart{}
+	if err := r.UnmarshalReply(cart); err != nil {
+		t.Fatal(err)
+	}
+	return cart
+}
+
+func TestTestKit(t *testing.T) {
+	t.Run("a command should reply and emit events", func(t *testing.T) {
+		tk := newTestKit(t, 0)
+		i, err := tk.Load("cart-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer i.Passivate()
+		r := addItem(t, i, "bike", 2)
+		if r.Failure != nil {
+			t.Fatalf("unexpected failure: %+v", r.Failure)
+		}
+		if got, want := len(r.Events), 1; got != want {
+			t.Fatalf("len(r.Events) = %d; want: %d", got, want)
+		}
+		added := &domain.ItemAdded{}
+		if err := r.UnmarshalEvent(0, added); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := added.GetItem().GetQuantity(), int32(2); got != want {
+			t.Fatalf("added.Item.Quantity = %d; want: %d", got, want)
+		}
+		if r.Snapshot != nil {
+			t.Fatalf("r.Snapshot = %+v; want: nil", r.Snapshot)
+		}
+		if got, want := tk.Journal().Sequence("cart-1"), int64(1); got != want {
+			t.Fatalf("Journal().Sequence() = %d; want: %d", got, want)
+		}
+	})
+
+	t.Run("a failed command should not persist events", func(t *testing.T) {
+		tk := newTestKit(t, 0)
+		i, err := tk.Load("cart-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer i.Passivate()
+		r := addItem(t, i, "bike", -1)
+		if r.Failure == nil {
+			t.Fatal("r.Failure = nil; want a failure")
+		}
+		if got, want := len(tk.Journal().Events("cart-1")), 0; got != want {
+			t.Fatalf("len(Journal().Events()) = %d; want: %d", got, want)
+		}
+	})
+
+	t.Run("snapshots should be taken every SnapshotEvery events", func(t *testing.T) {
+		tk := newTestKit(t, 2)
+		i, err := tk.Load("cart-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer i.Passivate()
+		if r := addItem(t, i, "bike", 1); r.Snapshot != nil {
+			t.Fatalf("r.Snapshot = %+v; want: nil", r.Snapshot)
+		}
+		r := addItem(t, i, "scooter", 1)
+		if r.Snapshot == nil {
+			t.Fatal("r.Snapshot = nil; want a snapshot")
+		}
+		cart := &domain.Cart{}
+		if err := encoding.UnmarshalAny(r.Snapshot, cart); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(cart.GetItems()), 2; got != want {
+			t.Fatalf("len(cart.Items) = %d; want: %d", got, want)
+		}
+		if got, want := tk.Journal().Snapshot("cart-1").GetSnapshotSequence(), int64(2); got != want {
+			t.Fatalf("SnapshotSequence = %d; want: %d", got, want)
+		}
+	})
+
+	t.Run("a negative SnapshotEvery should never take snapshots", func(t *testing.T) {
+		tk := newTestKit(t, -1)
+		i, err := tk.Load("cart-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer i.Passivate()
+		for n := 0; n < 3; n++ {
+			if r := addItem(t, i, "bike", 1); r.Snapshot != nil {
+				t.Fatalf("r.Snapshot = %+v; want: nil", r.Snapshot)
+			}
+		}
+	})
+
+	t.Run("an entity should recover from snapshot plus events and from events only", func(t *testing.T) {
+		tk := newTestKit(t, 2)
+		i, err := tk.Load("cart-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer i.Passivate()
+		addItem(t, i, "bike", 1)
+		addItem(t, i, "scooter", 1)
+		addItem(t, i, "bike", 3)
+		if err := i.Passivate(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := i.Command("GetCart", &shoppingcart.GetShoppingCart{UserId: "user1"}); err != ErrPassivated {
+			t.Fatalf("err = %v; want: %v", err, ErrPassivated)
+		}
+		for name, load := range map[string]func(eventsourced.EntityID) (*Instance, error){
+			"load":   tk.Load,
+			"replay": tk.Replay,
+		} {
+			i, err := load("cart-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer i.Passivate()
+			cart := getCart(t, i)
+			if got, want := len(cart.GetItems()), 2; got != want {
+				t.Fatalf("%s: len(cart.Items) = %d; want: %d", name, got, want)
+			}
+			if got, want := cart.GetItems()[0].GetQuantity(), int32(4); got != want {
+				t.Fatalf("%s: cart.Items[0].Quantity = %d; want: %d", name, got, want)
+			}
+			if err := i.Passivate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("a journal can be seeded with events", func(t *testing.T) {
+		tk := newTestKit(t, 0)
+		err := tk.Journal().Append("cart-1",
+			&domain.ItemAdded{Item: &domain.LineItem{ProductId: "bike", Name: "bike", Quantity: 1}},
+			&domain.ItemRemoved{ProductId: "bike"},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		i, err := tk.Load("cart-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer i.Passivate()
+		if got, want := len(getCart(t, i).GetItems()), 0; got != want {
+			t.Fatalf("len(cart.Items) = %d; want: %d", got, want)
+		}
+		addItem(t, i, "scooter", 1)
+		if got, want := tk.Journal().Sequence("cart-1"), int64(3); got != want {
+			t.Fatalf("Journal().Sequence() = %d; want: %d", got, want)
+		}
+	})
+
+	t.Run("journaled events should be handled deterministically", func(t *testing.T) {
+		tk := newTestKit(t, 2)
+		i, err := tk.Load("cart-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer i.Passivate()
+		addItem(t, i, "bike", 1)
+		addItem(t, i, "scooter", 1)
+		addItem(t, i, "bike", 3)
+		if err := tk.CheckDeterminism("cart-1"); err != nil {
+			t.Fatalf("CheckDeterminism() = %v; want: nil", err)
+		}
+	})
+
+	t.Run("a failing recovery should be reported by the first command", func(t *testing.T) {
+		tk := newTestKit(t, 0)
+		err := tk.Journal().Append("cart-1", &domain.ItemRemoved{ProductId: "bike"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		i, err := tk.Load("cart-1")
+		if err == nil {
+			defer i.Passivate()
+			_, err = i.Command("GetCart", &shoppingcart.GetShoppingCart{UserId: "user1"})
+		}
+		if err == nil {
+			t.Fatal("err = nil; want an error")
+		}
+	})
+}
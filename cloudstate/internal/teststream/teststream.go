@@ -0,0 +1,166 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package teststream connects the test kits of the entity types to the
+// stream handler of an entity server, in-memory and without gRPC.
+package teststream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+// ErrPassivated is returned for messages sent to a passivated entity.
+var ErrPassivated = errors.New("the entity instance has been passivated")
+
+// ServerStream is the server side of a connection. Test kits wrap it into
+// the gRPC server stream type of their entity type, converting the messages
+// sent and received.
+type ServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	in  chan proto.Message
+	out chan proto.Message
+}
+
+// Context returns the context of the stream, canceled once the connection
+// is closed.
+func (s *ServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// Send sends a message to the test kit.
+func (s *ServerStream) Send(out proto.Message) error {
+	select {
+	case s.out <- out:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+// Recv receives a message from the test kit. It returns io.EOF once the
+// connection was passivated.
+func (s *ServerStream) Recv() (proto.Message, error) {
+	select {
+	case in, ok := <-s.in:
+		if !ok {
+			return nil, io.EOF
+		}
+		return in, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+// Conn is the test kit side of a connection to a stream handler. Messages
+// sent by the test kit are received by the handler and messages sent by the
+// handler are received by the test kit, both unbuffered.
+type Conn struct {
+	stream  *ServerStream
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stopErr error
+	err     error
+}
+
+// Open runs the stream handler with a new connection.
+func Open(handle func(s *ServerStream) error) *Conn {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Conn{
+		stream: &ServerStream{
+			ctx: ctx,
+			in:  make(chan proto.Message),
+			out: make(chan proto.Message),
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		c.stopErr = handle(c.stream)
+		close(c.done)
+	}()
+	return c
+}
+
+// Send sends a message to the stream handler. Once the handler failed the
+// stream or stopped, the connection is not usable anymore and every call
+// returns an error.
+func (c *Conn) Send(in proto.Message) error {
+	if c.err != nil {
+		return c.err
+	}
+	select {
+	case c.stream.in <- in:
+		return nil
+	case out := <-c.stream.out:
+		if f, ok := out.(interface{ GetFailure() *protocol.Failure }); ok && f.GetFailure() != nil {
+			return c.Fail(f.GetFailure())
+		}
+		return fmt.Errorf("unexpected message received: %+v", out)
+	case <-c.done:
+		c.err = fmt.Errorf("entity stopped: %v", c.stopErr)
+		return c.err
+	}
+}
+
+// Recv receives a message from the stream handler.
+func (c *Conn) Recv() (proto.Message, error) {
+	select {
+	case out := <-c.stream.out:
+		return out, nil
+	case <-c.done:
+		c.err = fmt.Errorf("entity stopped: %v", c.stopErr)
+		return nil, c.err
+	}
+}
+
+// Fail records that the stream handler failed the stream with the given
+// failure and returns the resulting error.
+func (c *Conn) Fail(f *protocol.Failure) error {
+	c.err = fmt.Errorf("entity failed with: %s", f.GetDescription())
+	return c.err
+}
+
+// Passivate closes the stream, as the proxy does when the entity gets
+// passivated, and waits for the stream handler to return.
+func (c *Conn) Passivate() error {
+	if c.err == ErrPassivated {
+		return nil
+	}
+	close(c.stream.in)
+	defer c.cancel()
+	c.err = ErrPassivated
+	for {
+		select {
+		case <-c.stream.out:
+		case <-c.done:
+			return c.stopErr
+		}
+	}
+}
+
+// Close cancels the stream of a connection that is not used anymore, like
+// one failing to start, and waits for the stream handler to return.
+func (c *Conn) Close() {
+	c.cancel()
+	<-c.done
+}
@@ -0,0 +1,57 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package timeout limits the time command handlers of entities may take.
+package timeout
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrCommandTimeout is the error of a command handler that did not return
+// within the command timeout.
+var ErrCommandTimeout = errors.New("the command handler did not return within the command timeout")
+
+// Run runs f with a context derived from ctx that is done when the timeout
+// passes, if the timeout is set. It returns the error of that context if f
+// did not return before it was done. f is left running then, as a goroutine
+// cannot be stopped, and may still change the entity it handles a command
+// for. A panic of f is raised again by Run.
+func Run(ctx context.Context, timeout time.Duration, f func(ctx context.Context)) error {
+	if timeout <= 0 {
+		f(ctx)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			done <- recover()
+		}()
+		f(ctx)
+	}()
+	select {
+	case r := <-done:
+		if r != nil {
+			panic(r)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,52 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("f returning in time", func(t *testing.T) {
+		ran := false
+		if err := Run(context.Background(), time.Second, func(context.Context) { ran = true }); err != nil {
+			t.Fatal(err)
+		}
+		if !ran {
+			t.Fatal("f should have been run")
+		}
+	})
+
+	t.Run("f exceeding the timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		err := Run(context.Background(), time.Millisecond, func(context.Context) { <-release })
+		if err != context.DeadlineExceeded {
+			t.Fatalf("err = %v; want: %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("a panic of f is raised again", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r != "panic" {
+				t.Fatalf("recover() = %v; want: panic", r)
+			}
+		}()
+		_ = Run(context.Background(), time.Second, func(context.Context) { panic("panic") })
+	})
+}
@@ -0,0 +1,73 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics counts events of the Cloudstate entity runners. The counts
+// are published by the expvar package, keyed by the service name of the
+// entity they occurred for.
+package metrics
+
+import (
+	"expvar"
+)
+
+var (
+	commandTimeouts   = expvar.NewMap("cloudstate.command_timeouts")
+	commandsRejected  = expvar.NewMap("cloudstate.commands_rejected")
+	duplicatesDropped = expvar.NewMap("cloudstate.duplicates_dropped")
+)
+
+// CommandTimedOut counts a command of the given service that timed out.
+func CommandTimedOut(service string) {
+	commandTimeouts.Add(service, 1)
+}
+
+// CommandTimeouts returns the number of commands of the given service that
+// timed out.
+func CommandTimeouts(service string) int64 {
+	if v, ok := commandTimeouts.Get(service).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// CommandRejected counts a command of the given service that was rejected
+// as it exceeded the limits of the entity.
+func CommandRejected(service string) {
+	commandsRejected.Add(service, 1)
+}
+
+// CommandsRejected returns the number of commands of the given service that
+// were rejected.
+func CommandsRejected(service string) int64 {
+	if v, ok := commandsRejected.Get(service).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// DuplicateDropped counts a duplicate command of the given service that was
+// dropped.
+func DuplicateDropped(service string) {
+	duplicatesDropped.Add(service, 1)
+}
+
+// DuplicatesDropped returns the number of duplicate commands of the given
+// service that were dropped.
+func DuplicatesDropped(service string) int64 {
+	if v, ok := duplicatesDropped.Get(service).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
@@ -0,0 +1,84 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projection
+
+import (
+	"github.com/cloudstateio/go-support/cloudstate/action"
+	"github.com/cloudstateio/go-support/cloudstate/cloudevents"
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/proto"
+)
+
+// Event holds the CloudEvent attributes of an event received.
+type Event struct {
+	ID      string
+	Type    string
+	Source  string
+	Subject string
+}
+
+func eventOf(md *protocol.Metadata) Event {
+	// A malformed ce-time is not used here and leaves the other attributes
+	// parsed.
+	ce, _ := cloudevents.FromMetadata(md)
+	return Event{
+		ID:      ce.ID,
+		Type:    ce.Type,
+		Source:  ce.Source,
+		Subject: ce.Subject,
+	}
+}
+
+// Context is the context an event is handled with.
+type Context struct {
+	*action.Context
+	// Event is the event handled.
+	Event Event
+}
+
+// ForwardTo forwards the event handled as the given message to a command of
+// a view entity. A forward replaces any reply or forward set before.
+func (c *Context) ForwardTo(service, command string, msg proto.Message) error {
+	payload, err := encoding.MarshalAny(msg)
+	if err != nil {
+		return err
+	}
+	c.Forward(&protocol.Forward{
+		ServiceName: service,
+		CommandName: command,
+		Payload:     payload,
+		Metadata:    c.Metadata(),
+	})
+	return nil
+}
+
+// SideEffectTo emits the given message as a side effect to a command of a
+// view entity. Any number of side effects can be emitted for an event.
+func (c *Context) SideEffectTo(service, command string, msg proto.Message, synchronous bool) error {
+	payload, err := encoding.MarshalAny(msg)
+	if err != nil {
+		return err
+	}
+	c.SideEffect(&protocol.SideEffect{
+		ServiceName: service,
+		CommandName: command,
+		Payload:     payload,
+		Synchronous: synchronous,
+		Metadata:    c.Metadata(),
+	})
+	return nil
+}
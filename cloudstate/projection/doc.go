@@ -0,0 +1,25 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package projection builds read models from events consumed by actions
+// subscribed to an event log.
+//
+// A Projection is an action.EntityHandler for service methods having an
+// event_log source declared in their cloudstate.eventing options. Events are
+// dispatched to handlers registered per event type, duplicates are dropped
+// by their ce-id using an action.Dedup, and the offset handled per event
+// subject can be recorded in a value entity by TrackOffset commands. Handlers
+// update views by forwarding to, or emitting side effects for, view entities.
+package projection
@@ -0,0 +1,75 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projection
+
+import (
+	"errors"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// OffsetTracking records the offset of a projection by a side effect to a
+// value entity for every event handled. The offset of an event subject is
+// the ce-id of the last event handled for it.
+type OffsetTracking struct {
+	// ServiceName is the service of the value entity offsets are recorded
+	// with. Setting it is mandatory.
+	ServiceName string
+	// CommandName is the command offsets are recorded with. Setting it is
+	// mandatory.
+	CommandName string
+	// CommandFunc returns the command message recording an offset. It
+	// defaults to the TrackOffset given, keyed by the name of the projection.
+	CommandFunc func(o *TrackOffset) (proto.Message, error)
+}
+
+func (t *OffsetTracking) check() error {
+	if t.ServiceName == "" || t.CommandName == "" {
+		return errors.New("the offset tracking has to define a ServiceName and CommandName but did not")
+	}
+	return nil
+}
+
+func (t *OffsetTracking) track(ctx *Context, projection string) error {
+	o := &TrackOffset{
+		EntityKey:  projection,
+		Projection: projection,
+		Subject:    ctx.Event.Subject,
+		EventId:    ctx.Event.ID,
+	}
+	var msg proto.Message = o
+	var err error
+	if t.CommandFunc != nil {
+		if msg, err = t.CommandFunc(o); err != nil {
+			return err
+		}
+	}
+	payload, ok := msg.(*any.Any)
+	if !ok {
+		if payload, err = encoding.MarshalAny(msg); err != nil {
+			return err
+		}
+	}
+	ctx.SideEffect(&protocol.SideEffect{
+		ServiceName: t.ServiceName,
+		CommandName: t.CommandName,
+		Payload:     payload,
+	})
+	return nil
+}
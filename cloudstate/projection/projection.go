@@ -0,0 +1,156 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projection
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/cloudstateio/go-support/cloudstate/action"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+const dedupWindowDefault = 1000
+
+var (
+	contextType = reflect.TypeOf((*Context)(nil))
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	messageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+)
+
+// A HandlerFunc handles an event. For events serialized as JSON, the event
+// is the *any.Any received.
+type HandlerFunc func(ctx *Context, event proto.Message) error
+
+// Projection dispatches events to the handlers registered for their type.
+// Events of types without a handler are acknowledged and skipped.
+//
+// A handler returning an error fails the command, for the Cloudstate proxy to
+// redeliver the event later. Events are deduplicated by their ce-id with an
+// action.Dedup, so an event redelivered while it is handled or after it was
+// handled is dropped, as long as its id is remembered by the DedupStore.
+type Projection struct {
+	// Name identifies the projection. Setting it is mandatory.
+	Name string
+	// Offsets, if set, records the offset per event subject in a value entity.
+	Offsets *OffsetTracking
+	// DedupStore remembers the ids of events handled. It defaults to an
+	// action.RingStore of DedupWindow ids.
+	DedupStore action.DedupStore
+	// DedupWindow is the number of event ids remembered by the default
+	// DedupStore. It defaults to 1000.
+	DedupWindow int
+
+	handlers map[string]HandlerFunc
+}
+
+// New returns a new projection with the given name.
+func New(name string) *Projection {
+	return &Projection{
+		Name:     name,
+		handlers: make(map[string]HandlerFunc),
+	}
+}
+
+// Handle registers a typed event handler. The handler has to be a function
+// of the form
+//
+//	func(ctx *projection.Context, event *T) error
+//
+// where *T is a protobuf message type. It is called for events of that type.
+func (p *Projection) Handle(handler interface{}) error {
+	f := reflect.ValueOf(handler)
+	t := f.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 1 ||
+		t.In(0) != contextType || !t.In(1).Implements(messageType) || t.Out(0) != errorType {
+		return fmt.Errorf("a handler has to be of the form func(*projection.Context, proto.Message) error, but was: %s", t)
+	}
+	event := reflect.Zero(t.In(1)).Interface().(proto.Message)
+	return p.HandleType(proto.MessageName(event), func(ctx *Context, event proto.Message) error {
+		out := f.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(event)})
+		if err, _ := out[0].Interface().(error); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// HandleType registers an event handler by the events type name, the
+// message name for protobuf events and the type URL without its prefix
+// for others, like JSON events.
+func (p *Projection) HandleType(typeName string, handler HandlerFunc) error {
+	if p.handlers == nil {
+		p.handlers = make(map[string]HandlerFunc)
+	}
+	if _, exists := p.handlers[typeName]; exists {
+		return fmt.Errorf("a handler for event type %q is already registered", typeName)
+	}
+	p.handlers[typeName] = handler
+	return nil
+}
+
+// Entity returns an action entity for the given service, running the projection.
+// An error is returned if the projection or its offset tracking is incomplete.
+func (p *Projection) Entity(service action.ServiceName) (*action.Entity, error) {
+	if p.Name == "" {
+		return nil, errors.New("the projection has to define a Name but did not")
+	}
+	if p.Offsets != nil {
+		if err := p.Offsets.check(); err != nil {
+			return nil, err
+		}
+	}
+	if p.DedupStore == nil {
+		size := p.DedupWindow
+		if size <= 0 {
+			size = dedupWindowDefault
+		}
+		p.DedupStore = action.NewRingStore(size)
+	}
+	return &action.Entity{
+		ServiceName: service,
+		EntityFunc: func() action.EntityHandler {
+			return p
+		},
+		Dedup: &action.Dedup{Store: p.DedupStore},
+	}, nil
+}
+
+// HandleCommand handles an event received by an action command.
+func (p *Projection) HandleCommand(ctx *action.Context, _ string, msg proto.Message) error {
+	c := &Context{Context: ctx, Event: eventOf(ctx.Metadata())}
+	if handler, ok := p.handlers[typeName(msg)]; ok {
+		if err := handler(c, msg); err != nil {
+			return err
+		}
+	}
+	if p.Offsets != nil && c.Event.Subject != "" {
+		if err := p.Offsets.track(c, p.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func typeName(msg proto.Message) string {
+	if a, ok := msg.(*any.Any); ok {
+		return a.GetTypeUrl()[strings.Index(a.GetTypeUrl(), "/")+1:]
+	}
+	return proto.MessageName(msg)
+}
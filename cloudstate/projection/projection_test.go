@@ -0,0 +1,174 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projection
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/action"
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	domain "github.com/cloudstateio/go-support/example/shoppingcart/persistence"
+	"github.com/golang/protobuf/proto"
+)
+
+const service = "com.example.CartProjection"
+
+func newServer(t *testing.T, p *Projection) *action.Server {
+	t.Helper()
+	e, err := p.Entity(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := action.NewServer()
+	if err := s.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func eventCommand(t *testing.T, id, subject string, event interface{}) *entity.ActionCommand {
+	t.Helper()
+	payload, err := encoding.MarshalAny(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &entity.ActionCommand{
+		ServiceName: service,
+		Name:        "ProcessEvent",
+		Payload:     payload,
+		Metadata: &protocol.Metadata{Entries: []*protocol.MetadataEntry{
+			{Key: "ce-id", Value: &protocol.MetadataEntry_StringValue{StringValue: id}},
+			{Key: "ce-subject", Value: &protocol.MetadataEntry_StringValue{StringValue: subject}},
+		}},
+	}
+}
+
+func TestProjection(t *testing.T) {
+	newProjection := func(t *testing.T, fail *bool) *Projection {
+		p := New("carts")
+		p.Offsets = &OffsetTracking{ServiceName: "com.example.Offsets", CommandName: "Track"}
+		err := p.Handle(func(ctx *Context, e *domain.ItemAdded) error {
+			if *fail {
+				return errors.New("view unavailable")
+			}
+			return ctx.SideEffectTo("com.example.CartView", "Add", e.GetItem(), false)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	added := &domain.ItemAdded{Item: &domain.LineItem{ProductId: "bike", Quantity: 1}}
+
+	t.Run("events are dispatched by type and offsets are tracked", func(t *testing.T) {
+		fail := false
+		s := newServer(t, newProjection(t, &fail))
+		r, err := s.HandleUnary(context.Background(), eventCommand(t, "cart-1-1", "cart-1", added))
+		if err != nil {
+			t.Fatal(err)
+		}
+		effects := r.GetSideEffects()
+		if got, want := len(effects), 2; got != want {
+			t.Fatalf("len(effects) = %d; want: %d", got, want)
+		}
+		if got, want := effects[0].GetServiceName(), "com.example.CartView"; got != want {
+			t.Fatalf("effects[0].ServiceName = %q; want: %q", got, want)
+		}
+		var o TrackOffset
+		if err := encoding.UnmarshalAny(effects[1].GetPayload(), &o); err != nil {
+			t.Fatal(err)
+		}
+		want := &TrackOffset{EntityKey: "carts", Projection: "carts", Subject: "cart-1", EventId: "cart-1-1"}
+		if !proto.Equal(&o, want) {
+			t.Fatalf("offset = %+v; want: %+v", &o, want)
+		}
+	})
+
+	t.Run("events of types without a handler are skipped", func(t *testing.T) {
+		fail := false
+		s := newServer(t, newProjection(t, &fail))
+		r, err := s.HandleUnary(context.Background(), eventCommand(t, "cart-1-1", "cart-1", &domain.ItemRemoved{ProductId: "bike"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(r.GetSideEffects()), 1; got != want {
+			t.Fatalf("len(effects) = %d; want: %d", got, want)
+		}
+	})
+
+	t.Run("duplicates are dropped", func(t *testing.T) {
+		fail := false
+		s := newServer(t, newProjection(t, &fail))
+		for i, tc := range []struct {
+			id      string
+			effects int
+		}{
+			{"cart-1-2", 2},
+			{"cart-1-2", 0},
+			{"cart-1-1", 2},
+			{"cart-1-1", 0},
+		} {
+			r, err := s.HandleUnary(context.Background(), eventCommand(t, tc.id, "cart-1", added))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(r.GetSideEffects()); got != tc.effects {
+				t.Fatalf("%d: len(effects) = %d; want: %d", i, got, tc.effects)
+			}
+		}
+	})
+
+	t.Run("failed events are handled when redelivered", func(t *testing.T) {
+		fail := true
+		s := newServer(t, newProjection(t, &fail))
+		if _, err := s.HandleUnary(context.Background(), eventCommand(t, "cart-1-1", "cart-1", added)); err == nil {
+			t.Fatal("err = nil; want an error")
+		}
+		fail = false
+		r, err := s.HandleUnary(context.Background(), eventCommand(t, "cart-1-1", "cart-1", added))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(r.GetSideEffects()), 2; got != want {
+			t.Fatalf("len(effects) = %d; want: %d", got, want)
+		}
+	})
+
+	t.Run("handlers of the wrong form are rejected", func(t *testing.T) {
+		p := New("carts")
+		for _, h := range []interface{}{
+			func(ctx *Context, e string) error { return nil },
+			func(ctx *action.Context, e *domain.ItemAdded) error { return nil },
+			func(ctx *Context, e *domain.ItemAdded) {},
+			"handler",
+		} {
+			if err := p.Handle(h); err == nil {
+				t.Fatalf("handler %T should have been rejected", h)
+			}
+		}
+	})
+	t.Run("offset tracking without a command is rejected", func(t *testing.T) {
+		p := New("carts")
+		p.Offsets = &OffsetTracking{ServiceName: "com.example.Offsets"}
+		if _, err := p.Entity("com.example.CartProjection"); err == nil {
+			t.Fatal("Entity() = nil; want an error")
+		}
+	})
+}
@@ -0,0 +1,42 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protocol
+
+import "strings"
+
+// MergeMetadata returns the entries of md followed by the entries of
+// defaults with keys md has no entries for. Keys are compared case
+// insensitively. Neither md nor defaults are modified.
+func MergeMetadata(md, defaults *Metadata) *Metadata {
+	if len(defaults.GetEntries()) == 0 {
+		return md
+	}
+	if len(md.GetEntries()) == 0 {
+		return defaults
+	}
+	keys := make(map[string]bool, len(md.Entries))
+	merged := &Metadata{Entries: make([]*MetadataEntry, 0, len(md.Entries)+len(defaults.Entries))}
+	for _, e := range md.Entries {
+		keys[strings.ToLower(e.GetKey())] = true
+		merged.Entries = append(merged.Entries, e)
+	}
+	for _, e := range defaults.Entries {
+		if !keys[strings.ToLower(e.GetKey())] {
+			merged.Entries = append(merged.Entries, e)
+		}
+	}
+	return merged
+}
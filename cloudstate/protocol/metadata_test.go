@@ -0,0 +1,39 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protocol
+
+import "testing"
+
+func TestMergeMetadata(t *testing.T) {
+	entry := func(key, value string) *MetadataEntry {
+		return &MetadataEntry{Key: key, Value: &MetadataEntry_StringValue{StringValue: value}}
+	}
+	md := &Metadata{Entries: []*MetadataEntry{entry("a", "md"), entry("a", "md2")}}
+	defaults := &Metadata{Entries: []*MetadataEntry{entry("A", "defaults"), entry("b", "defaults")}}
+	merged := MergeMetadata(md, defaults)
+	if got, want := len(merged.GetEntries()), 3; got != want {
+		t.Fatalf("len(merged.Entries) = %d; want: %d", got, want)
+	}
+	if got, want := merged.GetEntries()[2].GetKey(), "b"; got != want {
+		t.Fatalf("merged.Entries[2].Key = %q; want: %q", got, want)
+	}
+	if got, want := len(md.GetEntries()), 2; got != want {
+		t.Fatalf("len(md.Entries) = %d; want md to be unchanged", got)
+	}
+	if MergeMetadata(nil, defaults) != defaults || MergeMetadata(md, nil) != md {
+		t.Fatal("merging with empty metadata should return the other one")
+	}
+}
@@ -2,10 +2,9 @@ package value
 
 import (
 	"context"
-	"fmt"
-	"reflect"
-	"strings"
 
+	"github.com/cloudstateio/go-support/cloudstate/cloudevents"
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
 	"github.com/cloudstateio/go-support/cloudstate/entity"
 	"github.com/cloudstateio/go-support/cloudstate/protocol"
 	"github.com/golang/protobuf/proto"
@@ -27,6 +26,28 @@ type Context struct {
 	failure     error
 	sideEffects []*protocol.SideEffect
 	state       *any.Any
+	// stateValue is the decoded state.
+	stateValue interface{}
+	// version is the version of the state of a versioned entity.
+	version int64
+	// migrated is set if the state was migrated and not persisted since.
+	migrated bool
+	// command is the command being handled.
+	command *protocol.Command
+	// replyMetadata is the metadata set to be replied.
+	replyMetadata *protocol.Metadata
+}
+
+// StreamCtx returns the context.Context from the stream this context is
+// assigned to.
+func (c *Context) StreamCtx() context.Context {
+	return c.ctx
+}
+
+// CloudEvent returns the CloudEvent attributes of the command the context
+// is handling, as described by cloudevents.FromMetadata.
+func (c *Context) CloudEvent() (cloudevents.Event, error) {
+	return cloudevents.FromMetadata(c.command.GetMetadata())
 }
 
 func (c *Context) Forward(forward *protocol.Forward) {
@@ -38,21 +59,50 @@ func (c *Context) SideEffect(effect *protocol.SideEffect) {
 	c.sideEffects = append(c.sideEffects, effect)
 }
 
-func (c *Context) entityReply(command *protocol.Command, reply *any.Any) *entity.ValueEntityReply {
+// SetReplyMetadata sets metadata to be sent with the reply to the command
+// the context is handling. A reply carries the metadata of the command,
+// where entries of the metadata set take precedence. If the command is
+// forwarded, the metadata set is added to the forward, where entries of the
+// forwards own metadata take precedence. Side effects carry their own
+// metadata only.
+func (c *Context) SetReplyMetadata(md *protocol.Metadata) {
+	c.replyMetadata = md
+}
+
+// forwardWithMetadata returns the forward set, with the reply metadata
+// added to it.
+func (c *Context) forwardWithMetadata() *protocol.Forward {
+	if len(c.replyMetadata.GetEntries()) == 0 {
+		return c.forward
+	}
+	forward := proto.Clone(c.forward).(*protocol.Forward)
+	forward.Metadata = protocol.MergeMetadata(forward.Metadata, c.replyMetadata)
+	return forward
+}
+
+func (c *Context) entityReply(command *protocol.Command, reply *any.Any) (*entity.ValueEntityReply, error) {
 	if c.failure != nil {
+		// A failed command emits no side effects and neither updates nor
+		// deletes the state. If an update or delete was requested, the
+		// entity is restarted as its instance might have changed state.
 		return &entity.ValueEntityReply{
 			CommandId: command.Id,
-			// SideEffects: c.sideEffects, // TODO: as per TCK we don't return sideEffect, why?
 			ClientAction: &protocol.ClientAction{
 				Action: &protocol.ClientAction_Failure{
 					Failure: &protocol.Failure{
 						CommandId:   command.Id,
 						Description: c.failure.Error(),
-						// Restart:     len(c.sideEffects) > 0, TODO: how do we support restarts?
-						Restart: false,
+						Restart:     c.update || c.delete,
 					},
 				},
 			},
+		}, nil
+	}
+	var state *any.Any
+	if c.update || (c.delete && c.Entity.Versioned) {
+		var err error
+		if state, err = c.persistedState(); err != nil {
+			return nil, err
 		}
 	}
 	if c.forward != nil && c.update {
@@ -60,44 +110,50 @@ func (c *Context) entityReply(command *protocol.Command, reply *any.Any) *entity
 			CommandId: command.Id,
 			ClientAction: &protocol.ClientAction{
 				Action: &protocol.ClientAction_Forward{
-					Forward: c.forward,
+					Forward: c.forwardWithMetadata(),
 				},
 			},
 			SideEffects: c.sideEffects,
 			StateAction: &entity.ValueEntityAction{
 				Action: &entity.ValueEntityAction_Update{
 					Update: &entity.ValueEntityUpdate{
-						Value: c.state,
+						Value: state,
 					},
 				},
 			},
-		}
+		}, nil
 	}
 	if c.forward != nil {
 		return &entity.ValueEntityReply{
 			CommandId: command.Id,
 			ClientAction: &protocol.ClientAction{
 				Action: &protocol.ClientAction_Forward{
-					Forward: c.forward,
+					Forward: c.forwardWithMetadata(),
 				},
 			},
 			SideEffects: c.sideEffects,
-		}
+		}, nil
 	}
 	if c.delete {
+		action := &entity.ValueEntityAction{
+			Action: &entity.ValueEntityAction_Delete{Delete: &entity.ValueEntityDelete{}},
+		}
+		if c.Entity.Versioned {
+			action = &entity.ValueEntityAction{
+				Action: &entity.ValueEntityAction_Update{Update: &entity.ValueEntityUpdate{Value: state}},
+			}
+		}
 		return &entity.ValueEntityReply{
 			CommandId: command.Id,
 			ClientAction: &protocol.ClientAction{
 				Action: &protocol.ClientAction_Reply{Reply: &protocol.Reply{
 					Payload:  reply,
-					Metadata: command.Metadata,
+					Metadata: c.replyMetadataFor(command),
 				}},
 			},
 			SideEffects: c.sideEffects,
-			StateAction: &entity.ValueEntityAction{
-				Action: &entity.ValueEntityAction_Delete{Delete: &entity.ValueEntityDelete{}},
-			},
-		}
+			StateAction: action,
+		}, nil
 	}
 	if c.update {
 		return &entity.ValueEntityReply{
@@ -105,18 +161,18 @@ func (c *Context) entityReply(command *protocol.Command, reply *any.Any) *entity
 			ClientAction: &protocol.ClientAction{
 				Action: &protocol.ClientAction_Reply{Reply: &protocol.Reply{
 					Payload:  reply,
-					Metadata: command.Metadata,
+					Metadata: c.replyMetadataFor(command),
 				}},
 			},
 			SideEffects: c.sideEffects,
 			StateAction: &entity.ValueEntityAction{
 				Action: &entity.ValueEntityAction_Update{
 					Update: &entity.ValueEntityUpdate{
-						Value: c.state,
+						Value: state,
 					},
 				},
 			},
-		}
+		}, nil
 	}
 	if reply != nil {
 		return &entity.ValueEntityReply{
@@ -124,36 +180,40 @@ func (c *Context) entityReply(command *protocol.Command, reply *any.Any) *entity
 			ClientAction: &protocol.ClientAction{
 				Action: &protocol.ClientAction_Reply{Reply: &protocol.Reply{
 					Payload:  reply,
-					Metadata: command.Metadata,
+					Metadata: c.replyMetadataFor(command),
 				}},
 			},
 			SideEffects: c.sideEffects,
-		}
+		}, nil
 	}
-	return nil
+	return nil, nil
 }
 
 func (c *Context) runCommand(cmd *protocol.Command) (*any.Any, error) {
-	// unmarshal the commands message
-	msgName := strings.TrimPrefix(cmd.GetPayload().GetTypeUrl(), "type.googleapis.com/")
-	if strings.HasPrefix(msgName, "json.cloudstate.io/") {
-		return c.Instance.HandleCommand(c, cmd.Name, cmd.Payload)
-	}
-	messageType := proto.MessageType(msgName)
-	message, ok := reflect.New(messageType.Elem()).Interface().(proto.Message)
-	if !ok {
-		return nil, fmt.Errorf("messageType is no proto.Message: %v", messageType)
+	c.command = cmd
+	if err := c.checkVersion(cmd.Metadata); err != nil {
+		return nil, err
 	}
-	if err := proto.Unmarshal(cmd.Payload.Value, message); err != nil {
+	message, err := encoding.DefaultRegistry.DecodeMessage(cmd.GetPayload())
+	if err != nil {
 		return nil, err
 	}
-	return c.Instance.HandleCommand(c, cmd.Name, message)
+	return c.handleCommand(cmd.Name, message)
+}
+
+func (c *Context) handleCommand(name string, msg proto.Message) (*any.Any, error) {
+	reply, err := c.Instance.HandleCommand(c, name, msg)
+	if err == nil {
+		c.writeBackMigrated()
+	}
+	return reply, err
 }
 
 func (c *Context) Delete() {
 	c.update = false
 	c.delete = true
 	c.state = nil
+	c.stateValue = nil
 }
 
 func (c *Context) Update(state *any.Any, err error) error {
@@ -163,6 +223,7 @@ func (c *Context) Update(state *any.Any, err error) error {
 	c.update = true
 	c.delete = false
 	c.state = state
+	c.stateValue = nil
 	return nil
 }
 
@@ -172,4 +233,6 @@ func (c *Context) reset() {
 	c.forward = nil
 	c.failure = nil
 	c.sideEffects = nil
+	c.command = nil
+	c.replyMetadata = nil
 }
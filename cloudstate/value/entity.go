@@ -1,6 +1,8 @@
 package value
 
 import (
+	"time"
+
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes/any"
 )
@@ -12,9 +14,45 @@ type Entity struct {
 	// EntityFunc creates a new entity.
 	EntityFunc    func(EntityID) EntityHandler
 	PersistenceID string
+	// StateFunc, if set, returns a new value of the type of the entities
+	// state, a pointer to a protobuf message or to a struct to be serialized
+	// as JSON. The state is then decoded before HandleState is called and
+	// accessible by Context.State and Context.SetState.
+	StateFunc func() interface{}
+	// Versioned enables optimistic concurrency for the entity. The state is
+	// persisted as a VersionedState with a version incremented on every
+	// update and delete. A deleted state is persisted as a tombstone keeping
+	// its version, so that a version never repeats. A command can
+	// expect a version by the IfMatchKey metadata entry and fails with a
+	// client error if the state has another version. Replies carry the
+	// version of the state by the ETagKey metadata entry.
+	Versioned bool
+	// Migrations, if set, convert states persisted with older types, keyed
+	// by their type URL. A state is migrated before it is decoded and passed
+	// to HandleState, by as many migrations as its type has in a row.
+	Migrations map[string]Migration
+	// WriteBackMigrated, if set, persists a migrated state with the next
+	// command that succeeds, even if the command does not update the state.
+	// Otherwise a migrated state is persisted with the next update only.
+	WriteBackMigrated bool
+	// CommandTimeout, if set, limits the time a command handler may take.
+	// The context returned by Context.StreamCtx has the deadline of the
+	// command while it is handled. If a handler does not return in time, a
+	// client failure is sent, the entity is restarted and the timeout is
+	// counted by the metrics package. The handler is not stopped though and
+	// keeps running in its goroutine, possibly still mutating the entity
+	// instance. Handlers should therefore return once the context is done.
+	CommandTimeout time.Duration
 }
 
 type EntityHandler interface {
 	HandleCommand(ctx *Context, name string, msg proto.Message) (*any.Any, error)
 	HandleState(ctx *Context, state *any.Any) error
 }
+
+// A DeleteHandler is an EntityHandler notified when a command has deleted
+// its state. OnDelete is called after the reply to the command was sent. The
+// entity may be updated by later commands again.
+type DeleteHandler interface {
+	OnDelete(ctx *Context) error
+}
@@ -0,0 +1,53 @@
+package value
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// A Migration converts a state persisted with an older type into a state of
+// a newer type.
+type Migration func(state *any.Any) (*any.Any, error)
+
+// migrateState runs the migrations registered for the type of the state,
+// one after the other, until the state has a type without a migration.
+func (c *Context) migrateState() error {
+	if len(c.Entity.Migrations) == 0 || c.state == nil {
+		return nil
+	}
+	for i := 0; ; i++ {
+		m, ok := c.Entity.Migrations[c.state.GetTypeUrl()]
+		if !ok {
+			return nil
+		}
+		if i == len(c.Entity.Migrations) {
+			return fmt.Errorf("the migrations of the state of type %q form a cycle", c.state.GetTypeUrl())
+		}
+		state, err := m(c.state)
+		if err != nil {
+			return fmt.Errorf("migration of the state of type %q failed: %w", c.state.GetTypeUrl(), err)
+		}
+		if state == nil {
+			return fmt.Errorf("migration of the state of type %q returned no state", c.state.GetTypeUrl())
+		}
+		c.state = state
+		c.migrated = true
+	}
+}
+
+// writeBackMigrated requests a migrated state to be updated, if the entity
+// writes back migrated states and the command did not update or delete it.
+func (c *Context) writeBackMigrated() {
+	if c.migrated && c.Entity.WriteBackMigrated && !c.update && !c.delete {
+		c.update = true
+	}
+}
+
+// commit records the state of a command replied to as persisted.
+func (c *Context) commit() {
+	c.commitVersion()
+	if c.failure == nil && (c.update || c.delete) {
+		c.migrated = false
+	}
+}
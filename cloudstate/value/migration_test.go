@@ -0,0 +1,132 @@
+package value
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+// readingEntity replies with its state, without updating it.
+type readingEntity struct {
+	state string
+}
+
+func (e *readingEntity) HandleCommand(ctx *Context, _ string, _ proto.Message) (*any.Any, error) {
+	return encoding.MarshalAny(&wrappers.StringValue{Value: e.state})
+}
+
+func (e *readingEntity) HandleState(ctx *Context, _ *any.Any) error {
+	e.state = ctx.State().(*wrappers.StringValue).GetValue()
+	return nil
+}
+
+func migrations(t *testing.T) map[string]Migration {
+	t.Helper()
+	typeURL := func(m proto.Message) string {
+		a, err := encoding.MarshalAny(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a.GetTypeUrl()
+	}
+	return map[string]Migration{
+		typeURL(&wrappers.Int32Value{}): func(state *any.Any) (*any.Any, error) {
+			v := &wrappers.Int32Value{}
+			if err := encoding.UnmarshalAny(state, v); err != nil {
+				return nil, err
+			}
+			return encoding.MarshalAny(&wrappers.Int64Value{Value: int64(v.Value)})
+		},
+		typeURL(&wrappers.Int64Value{}): func(state *any.Any) (*any.Any, error) {
+			v := &wrappers.Int64Value{}
+			if err := encoding.UnmarshalAny(state, v); err != nil {
+				return nil, err
+			}
+			return encoding.MarshalAny(&wrappers.StringValue{Value: strconv.FormatInt(v.Value, 10)})
+		},
+	}
+}
+
+func newMigratingServer(t *testing.T, writeBack bool) *Server {
+	t.Helper()
+	server := NewServer()
+	err := server.Register(&Entity{
+		ServiceName: "failing",
+		EntityFunc: func(EntityID) EntityHandler {
+			return &readingEntity{}
+		},
+		StateFunc:         func() interface{} { return &wrappers.StringValue{} },
+		Migrations:        migrations(t),
+		WriteBackMigrated: writeBack,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func TestMigrations(t *testing.T) {
+	newMigratingStream := func(t *testing.T, commands ...string) *stream {
+		state, err := encoding.MarshalAny(&wrappers.Int32Value{Value: 42})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newStream(t, commands...)
+		s.in[0].GetInit().State = &entity.ValueEntityInitState{Value: state}
+		return s
+	}
+	reply := func(t *testing.T, out *entity.ValueEntityStreamOut) string {
+		t.Helper()
+		v := &wrappers.StringValue{}
+		if err := encoding.UnmarshalAny(out.GetReply().GetClientAction().GetReply().GetPayload(), v); err != nil {
+			t.Fatal(err)
+		}
+		return v.GetValue()
+	}
+
+	t.Run("an old state is migrated before HandleState", func(t *testing.T) {
+		s := newMigratingStream(t, "Reply")
+		if err := newMigratingServer(t, false).Handle(s); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := reply(t, s.sent[0]), "42"; got != want {
+			t.Fatalf("reply = %q; want: %q", got, want)
+		}
+		if s.sent[0].GetReply().GetStateAction() != nil {
+			t.Fatal("a migrated state should not be written back")
+		}
+	})
+
+	t.Run("a migrated state is written back once", func(t *testing.T) {
+		s := newMigratingStream(t, "Reply", "Reply")
+		if err := newMigratingServer(t, true).Handle(s); err != nil {
+			t.Fatal(err)
+		}
+		state := &wrappers.StringValue{}
+		if err := encoding.UnmarshalAny(s.sent[0].GetReply().GetStateAction().GetUpdate().GetValue(), state); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := state.GetValue(), "42"; got != want {
+			t.Fatalf("state = %q; want: %q", got, want)
+		}
+		if s.sent[1].GetReply().GetStateAction() != nil {
+			t.Fatal("a migrated state should be written back once")
+		}
+	})
+
+	t.Run("a failing migration fails the entity", func(t *testing.T) {
+		s := newStream(t, "Reply")
+		s.in[0].GetInit().State = &entity.ValueEntityInitState{Value: &any.Any{
+			TypeUrl: "type.googleapis.com/google.protobuf.Int32Value",
+			Value:   []byte{0xff},
+		}}
+		if err := newMigratingServer(t, false).Handle(s); err == nil {
+			t.Fatal("Handle() = nil; want an error")
+		}
+	})
+}
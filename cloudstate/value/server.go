@@ -1,13 +1,20 @@
 package value
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"sync"
 
 	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/internal/timeout"
+	"github.com/cloudstateio/go-support/cloudstate/metrics"
 	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type (
@@ -48,8 +55,48 @@ func (s *Server) Register(e *Entity) error {
 	return nil
 }
 
+// Handle handles the stream. One stream will be established per active entity.
+// Once established, the first message sent will be Init, which contains the
+// entity ID, and, if the entity has previously persisted a state, it will
+// contain that state. Then commands are sent and the entity is expected to
+// reply to each command with exactly one reply message.
+//
+// A command handler returning a protocol.ClientError fails the command with a
+// ClientAction_Failure sent to the client. A failed command neither updates
+// nor deletes the state and emits no side effects. The failure requests the
+// entity to be restarted if the command requested the state to be updated or
+// deleted, as the entity instance might have changed its state before failing.
+//
+// Any other error returned, and any panic, closes the stream after a
+// protocol.Failure was sent, carrying the id of the command that failed.
 func (s *Server) Handle(stream entity.ValueEntity_HandleServer) error {
+	defer func() {
+		if r := recover(); r != nil {
+			// on a panic we try to tell the proxy and panic again.
+			_ = sendProtocolFailure(fmt.Errorf("Server.Handle panic-ked with: %v", r), stream)
+			panic(r)
+		}
+	}()
+	// For any error we get other than codes.Canceled,
+	// we send a protocol.Failure and close the stream.
+	if err := s.handle(stream); err != nil {
+		if status.Code(err) == codes.Canceled {
+			return err
+		}
+		log.Print(err)
+		if sendErr := sendProtocolFailure(err, stream); sendErr != nil {
+			log.Print(sendErr)
+		}
+		return status.Error(codes.Aborted, err.Error())
+	}
+	return nil
+}
+
+func (s *Server) handle(stream entity.ValueEntity_HandleServer) error {
 	init, err := stream.Recv()
+	if err == io.EOF {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -72,11 +119,21 @@ func (s *Server) Handle(stream entity.ValueEntity_HandleServer) error {
 	}
 
 	if state := init.GetInit().GetState().GetValue(); state != nil {
-		err = c.Instance.HandleState(c, state)
+		if err := c.unwrapState(state); err != nil {
+			return err
+		}
+	}
+	if c.state != nil {
+		if err := c.migrateState(); err != nil {
+			return err
+		}
+		if err := c.decodeState(); err != nil {
+			return err
+		}
+		err = c.Instance.HandleState(c, c.state)
 		if err != nil {
 			return err
 		}
-		c.state = state
 	}
 	for {
 		msg, err := stream.Recv()
@@ -88,20 +145,80 @@ func (s *Server) Handle(stream entity.ValueEntity_HandleServer) error {
 		}
 		switch m := msg.GetMessage().(type) {
 		case *entity.ValueEntityStreamIn_Command:
-			reply, err := c.runCommand(m.Command)
-			if err != nil && !errors.Is(err, protocol.ClientError{}) {
+			committed := c.state
+			var reply *any.Any
+			var cmdErr error
+			streamCtx := c.ctx
+			err := timeout.Run(streamCtx, e.CommandTimeout, func(ctx context.Context) {
+				c.ctx = ctx
+				reply, cmdErr = c.runCommand(m.Command)
+			})
+			if err == context.DeadlineExceeded {
+				// The handler still runs and might change the entity further,
+				// which therefore gets restarted by the proxy.
+				metrics.CommandTimedOut(e.ServiceName.String())
+				return stream.Send(&entity.ValueEntityStreamOut{
+					Message: &entity.ValueEntityStreamOut_Reply{
+						Reply: &entity.ValueEntityReply{
+							CommandId: m.Command.Id,
+							ClientAction: &protocol.ClientAction{
+								Action: &protocol.ClientAction_Failure{
+									Failure: &protocol.Failure{
+										CommandId:   m.Command.Id,
+										Description: timeout.ErrCommandTimeout.Error(),
+										Restart:     true,
+									},
+								},
+							},
+						},
+					},
+				})
+			}
+			if err != nil {
 				return err
 			}
+			c.ctx = streamCtx
+			err = cmdErr
+			if err != nil && !errors.Is(err, protocol.ClientError{}) {
+				if _, ok := err.(protocol.ServerError); ok {
+					return err
+				}
+				return protocol.ServerError{
+					Failure: &protocol.Failure{CommandId: m.Command.Id},
+					Err:     err,
+				}
+			}
 			c.failure = err
+			if c.failure != nil {
+				// The state of a failed command is not persisted.
+				c.state = committed
+				if err := c.decodeState(); err != nil {
+					return err
+				}
+			}
+			entityReply, err := c.entityReply(m.Command, reply)
+			if err != nil {
+				return protocol.ServerError{
+					Failure: &protocol.Failure{CommandId: m.Command.Id},
+					Err:     err,
+				}
+			}
 			err = stream.Send(&entity.ValueEntityStreamOut{
 				Message: &entity.ValueEntityStreamOut_Reply{
-					Reply: c.entityReply(m.Command, reply),
+					Reply: entityReply,
 				},
 			})
+			deleted := c.delete && c.failure == nil
+			c.commit()
+			c.reset()
 			if err != nil {
 				return err
 			}
-			c.reset()
+			if h, ok := c.Instance.(DeleteHandler); ok && deleted {
+				if err := h.OnDelete(c); err != nil {
+					return err
+				}
+			}
 		case *entity.ValueEntityStreamIn_Init:
 			if EntityID(m.Init.EntityId) == c.EntityID {
 				return errors.New("duplicate init message for the same entity")
@@ -0,0 +1,309 @@
+package value
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/metrics"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+)
+
+// stream is a entity.ValueEntity_HandleServer receiving a fixed sequence of
+// messages and recording messages sent.
+type stream struct {
+	grpc.ServerStream
+	in   []*entity.ValueEntityStreamIn
+	sent []*entity.ValueEntityStreamOut
+}
+
+func (s *stream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *stream) Send(out *entity.ValueEntityStreamOut) error {
+	s.sent = append(s.sent, out)
+	return nil
+}
+
+func (s *stream) Recv() (*entity.ValueEntityStreamIn, error) {
+	if len(s.in) == 0 {
+		return nil, io.EOF
+	}
+	in := s.in[0]
+	s.in = s.in[1:]
+	return in, nil
+}
+
+// failingEntity updates its state, emits a side effect and then fails or
+// deletes its state the way the command name says.
+type failingEntity struct{}
+
+func (failingEntity) HandleCommand(ctx *Context, name string, _ proto.Message) (*any.Any, error) {
+	if err := ctx.SetState(&wrappers.StringValue{Value: name}); err != nil {
+		return nil, err
+	}
+	ctx.SideEffect(&protocol.SideEffect{ServiceName: "other", CommandName: "Call"})
+	switch name {
+	case "ClientError":
+		return nil, protocol.ClientError{Err: errors.New("client error")}
+	case "Error":
+		return nil, errors.New("error")
+	case "Panic":
+		panic("panic")
+	case "Block":
+		<-ctx.StreamCtx().Done()
+	case "Delete":
+		ctx.Delete()
+	}
+	return encoding.MarshalAny(&wrappers.StringValue{Value: name})
+}
+
+func (failingEntity) HandleState(*Context, *any.Any) error {
+	return nil
+}
+
+func newStream(t *testing.T, commands ...string) *stream {
+	t.Helper()
+	payload, err := encoding.MarshalAny(&wrappers.StringValue{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stream{in: []*entity.ValueEntityStreamIn{{
+		Message: &entity.ValueEntityStreamIn_Init{Init: &entity.ValueEntityInit{
+			ServiceName: "failing",
+			EntityId:    "entity-0",
+		}},
+	}}}
+	for i, name := range commands {
+		s.in = append(s.in, &entity.ValueEntityStreamIn{
+			Message: &entity.ValueEntityStreamIn_Command{Command: &protocol.Command{
+				EntityId: "entity-0",
+				Id:       int64(i + 1),
+				Name:     name,
+				Payload:  payload,
+			}},
+		})
+	}
+	return s
+}
+
+func newServer(t *testing.T) *Server {
+	t.Helper()
+	server := NewServer()
+	err := server.Register(&Entity{
+		ServiceName: "failing",
+		EntityFunc: func(EntityID) EntityHandler {
+			return failingEntity{}
+		},
+		StateFunc:      func() interface{} { return &wrappers.StringValue{} },
+		CommandTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func TestHandleFailures(t *testing.T) {
+	t.Run("a client error fails the command only", func(t *testing.T) {
+		s := newStream(t, "ClientError", "Reply")
+		if err := newServer(t).Handle(s); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(s.sent), 2; got != want {
+			t.Fatalf("len(sent) = %d; want: %d", got, want)
+		}
+		reply := s.sent[0].GetReply()
+		failure := reply.GetClientAction().GetFailure()
+		if failure == nil {
+			t.Fatal("a client action failure should have been sent")
+		}
+		if got, want := failure.GetCommandId(), int64(1); got != want {
+			t.Fatalf("failure.CommandId = %d; want: %d", got, want)
+		}
+		if !failure.GetRestart() {
+			t.Fatal("failure.Restart should be set for a command that updated the state")
+		}
+		if len(reply.GetSideEffects()) > 0 || reply.GetStateAction() != nil {
+			t.Fatal("a failed command should emit no side effects and no state action")
+		}
+		if s.sent[1].GetReply().GetClientAction().GetReply() == nil {
+			t.Fatal("the next command should be replied to")
+		}
+	})
+
+	t.Run("an error sends a protocol failure with the command id", func(t *testing.T) {
+		s := newStream(t, "Reply", "Error", "Reply")
+		if err := newServer(t).Handle(s); err == nil {
+			t.Fatal("Handle() = nil; want an error")
+		}
+		if got, want := len(s.sent), 2; got != want {
+			t.Fatalf("len(sent) = %d; want: %d", got, want)
+		}
+		failure := s.sent[1].GetFailure()
+		if failure == nil {
+			t.Fatal("a protocol failure should have been sent")
+		}
+		if got, want := failure.GetCommandId(), int64(2); got != want {
+			t.Fatalf("failure.CommandId = %d; want: %d", got, want)
+		}
+		if got, want := failure.GetDescription(), "error"; got != want {
+			t.Fatalf("failure.Description = %q; want: %q", got, want)
+		}
+	})
+
+	t.Run("a panic sends a protocol failure and panics again", func(t *testing.T) {
+		s := newStream(t, "Panic")
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("Handle() should have panicked")
+			}
+			if len(s.sent) != 1 || s.sent[0].GetFailure() == nil {
+				t.Fatalf("a protocol failure should have been sent: %+v", s.sent)
+			}
+		}()
+		_ = newServer(t).Handle(s)
+	})
+
+	t.Run("a command timing out fails and restarts the entity", func(t *testing.T) {
+		timeouts := metrics.CommandTimeouts("failing")
+		s := newStream(t, "Reply", "Block", "Reply")
+		if err := newServer(t).Handle(s); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(s.sent), 2; got != want {
+			t.Fatalf("len(sent) = %d; want: %d", got, want)
+		}
+		failure := s.sent[1].GetReply().GetClientAction().GetFailure()
+		if failure == nil || !failure.GetRestart() {
+			t.Fatalf("a client action failure with restart should have been sent: %+v", s.sent[1])
+		}
+		if got, want := metrics.CommandTimeouts("failing"), timeouts+1; got != want {
+			t.Fatalf("CommandTimeouts() = %d; want: %d", got, want)
+		}
+	})
+}
+
+// deletingEntity deletes its state and counts the calls of OnDelete.
+type deletingEntity struct {
+	deleted *int
+}
+
+func (e deletingEntity) HandleCommand(ctx *Context, name string, _ proto.Message) (*any.Any, error) {
+	ctx.Delete()
+	if name == "ClientError" {
+		return nil, protocol.ClientError{Err: errors.New("client error")}
+	}
+	return encoding.MarshalAny(&wrappers.StringValue{Value: name})
+}
+
+func (deletingEntity) HandleState(*Context, *any.Any) error {
+	return nil
+}
+
+func (e deletingEntity) OnDelete(*Context) error {
+	*e.deleted++
+	return nil
+}
+
+func TestOnDelete(t *testing.T) {
+	deleted := 0
+	server := NewServer()
+	err := server.Register(&Entity{
+		ServiceName: "failing",
+		EntityFunc: func(EntityID) EntityHandler {
+			return deletingEntity{deleted: &deleted}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newStream(t, "Delete", "ClientError", "Delete")
+	if err := server.Handle(s); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(s.sent), 3; got != want {
+		t.Fatalf("len(sent) = %d; want: %d", got, want)
+	}
+	if got, want := deleted, 2; got != want {
+		t.Fatalf("OnDelete calls = %d; want: %d", got, want)
+	}
+}
+
+// metadataEntity sets reply metadata and forwards commands named "Forward".
+type metadataEntity struct{}
+
+func (metadataEntity) HandleCommand(ctx *Context, name string, _ proto.Message) (*any.Any, error) {
+	ctx.SetReplyMetadata(&protocol.Metadata{Entries: []*protocol.MetadataEntry{
+		{Key: "Header", Value: &protocol.MetadataEntry_StringValue{StringValue: "replied"}},
+		{Key: "reply", Value: &protocol.MetadataEntry_StringValue{StringValue: name}},
+	}})
+	if name == "Forward" {
+		ctx.Forward(&protocol.Forward{
+			ServiceName: "other",
+			CommandName: "Other",
+			Metadata: &protocol.Metadata{Entries: []*protocol.MetadataEntry{
+				{Key: "reply", Value: &protocol.MetadataEntry_StringValue{StringValue: "forwarded"}},
+			}},
+		})
+		return nil, nil
+	}
+	return encoding.MarshalAny(&wrappers.StringValue{Value: name})
+}
+
+func (metadataEntity) HandleState(*Context, *any.Any) error {
+	return nil
+}
+
+func TestReplyMetadata(t *testing.T) {
+	server := NewServer()
+	err := server.Register(&Entity{
+		ServiceName: "failing",
+		EntityFunc: func(EntityID) EntityHandler {
+			return metadataEntity{}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newStream(t, "Reply", "Forward")
+	for _, in := range s.in[1:] {
+		in.GetCommand().Metadata = &protocol.Metadata{Entries: []*protocol.MetadataEntry{
+			{Key: "header", Value: &protocol.MetadataEntry_StringValue{StringValue: "command"}},
+			{Key: "command", Value: &protocol.MetadataEntry_StringValue{StringValue: "command"}},
+		}}
+	}
+	if err := server.Handle(s); err != nil {
+		t.Fatal(err)
+	}
+	values := func(md *protocol.Metadata) map[string]string {
+		m := make(map[string]string)
+		for _, e := range md.GetEntries() {
+			m[e.GetKey()] = e.GetStringValue()
+		}
+		return m
+	}
+	reply := values(s.sent[0].GetReply().GetClientAction().GetReply().GetMetadata())
+	if got, want := len(reply), 3; got != want {
+		t.Fatalf("len(reply.Metadata) = %d; want: %d", got, want)
+	}
+	if reply["Header"] != "replied" || reply["reply"] != "Reply" || reply["command"] != "command" {
+		t.Fatalf("reply.Metadata = %v; want the metadata set to take precedence over the commands one", reply)
+	}
+	forward := values(s.sent[1].GetReply().GetClientAction().GetForward().GetMetadata())
+	if got, want := len(forward), 2; got != want {
+		t.Fatalf("len(forward.Metadata) = %d; want: %d", got, want)
+	}
+	if forward["reply"] != "forwarded" || forward["Header"] != "replied" {
+		t.Fatalf("forward.Metadata = %v; want the forwards metadata to take precedence over the metadata set", forward)
+	}
+}
@@ -0,0 +1,54 @@
+package value
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+)
+
+// State returns the state of the entity, decoded into the type returned by
+// Entity.StateFunc. If there is no state yet, a new value returned by
+// StateFunc is returned. State returns nil if the entity does not define a
+// StateFunc and no state was set. Changes to the state returned are
+// persisted only by passing it to SetState.
+func (c *Context) State() interface{} {
+	if c.stateValue == nil && c.state != nil {
+		// An error leaves the state to be the default, as for an entity
+		// having updated its state with an incompatible type.
+		_ = c.decodeState()
+	}
+	if c.stateValue == nil && c.Entity.StateFunc != nil {
+		c.stateValue = c.Entity.StateFunc()
+	}
+	return c.stateValue
+}
+
+// SetState sets the state of the entity to be updated. The state is encoded
+// by encoding.DefaultRegistry, protobuf messages as such, primitive values
+// as primitives and other values as JSON.
+func (c *Context) SetState(state interface{}) error {
+	if state == nil {
+		return errors.New("the state must not be nil")
+	}
+	if err := c.Update(encoding.DefaultRegistry.Encode(state)); err != nil {
+		return err
+	}
+	c.stateValue = state
+	return nil
+}
+
+// decodeState decodes the serialized state into a new value returned by
+// Entity.StateFunc.
+func (c *Context) decodeState() error {
+	c.stateValue = nil
+	if c.Entity.StateFunc == nil || c.state == nil {
+		return nil
+	}
+	state := c.Entity.StateFunc()
+	if err := encoding.DefaultRegistry.DecodeInto(c.state, state); err != nil {
+		return fmt.Errorf("decoding of the state failed: %w", err)
+	}
+	c.stateValue = state
+	return nil
+}
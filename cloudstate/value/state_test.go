@@ -0,0 +1,86 @@
+package value
+
+import (
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+type jsonState struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestState(t *testing.T) {
+	t.Run("a protobuf state is decoded and encoded", func(t *testing.T) {
+		state, err := encoding.MarshalAny(&wrappers.StringValue{Value: "initial"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := &Context{
+			Entity: &Entity{StateFunc: func() interface{} { return &wrappers.StringValue{} }},
+			state:  state,
+		}
+		if err := c.decodeState(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := c.State().(*wrappers.StringValue).GetValue(), "initial"; got != want {
+			t.Fatalf("State() = %q; want: %q", got, want)
+		}
+		if err := c.SetState(&wrappers.StringValue{Value: "updated"}); err != nil {
+			t.Fatal(err)
+		}
+		if !c.update {
+			t.Fatal("SetState should update the state")
+		}
+		updated := &wrappers.StringValue{}
+		if err := encoding.UnmarshalAny(c.state, updated); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := updated.GetValue(), "updated"; got != want {
+			t.Fatalf("state = %q; want: %q", got, want)
+		}
+	})
+
+	t.Run("a JSON state is decoded and encoded", func(t *testing.T) {
+		c := &Context{Entity: &Entity{StateFunc: func() interface{} { return &jsonState{} }}}
+		if got, want := *c.State().(*jsonState), (jsonState{}); got != want {
+			t.Fatalf("State() = %+v; want: %+v", got, want)
+		}
+		if err := c.SetState(&jsonState{Name: "one", Count: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.decodeState(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := *c.State().(*jsonState), (jsonState{Name: "one", Count: 1}); got != want {
+			t.Fatalf("State() = %+v; want: %+v", got, want)
+		}
+	})
+
+	t.Run("a deleted state is the default state", func(t *testing.T) {
+		c := &Context{Entity: &Entity{StateFunc: func() interface{} { return &jsonState{} }}}
+		if err := c.SetState(&jsonState{Name: "one", Count: 1}); err != nil {
+			t.Fatal(err)
+		}
+		c.Delete()
+		if got, want := *c.State().(*jsonState), (jsonState{}); got != want {
+			t.Fatalf("State() = %+v; want: %+v", got, want)
+		}
+	})
+
+	t.Run("a protobuf state can't be decoded into a JSON state", func(t *testing.T) {
+		state, err := encoding.MarshalAny(&wrappers.StringValue{Value: "initial"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := &Context{
+			Entity: &Entity{StateFunc: func() interface{} { return jsonState{} }},
+			state:  state,
+		}
+		if err := c.decodeState(); err == nil {
+			t.Fatal("decodeState() = nil; want an error")
+		}
+	})
+}
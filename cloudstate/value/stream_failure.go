@@ -0,0 +1,43 @@
+package value
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+)
+
+// sendProtocolFailure sends a given error to the proxy. If the error is a
+// protocol.ServerError a corresponding command id is unwrapped and added to
+// the failure. Any other failure is sent as a protocol failure.
+//
+// A protocol.ClientError is sent as a protocol.ClientAction_Failure for the
+// client to be informed about, see Context.entityReply. Any other error is
+// sent as a protocol.Failure and closes the stream.
+func sendProtocolFailure(e error, s entity.ValueEntity_HandleServer) error {
+	var commandID int64 = 0
+	var desc = e.Error()
+	var se protocol.ServerError
+	if errors.As(e, &se) {
+		commandID = se.Failure.CommandId
+		desc = se.Failure.Description
+		if desc == "" {
+			if u := errors.Unwrap(e); u != nil {
+				desc = u.Error()
+			}
+		}
+	}
+	err := s.Send(&entity.ValueEntityStreamOut{
+		Message: &entity.ValueEntityStreamOut_Failure{
+			Failure: &protocol.Failure{
+				CommandId:   commandID,
+				Description: desc,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("send of ValueEntityStreamOut.Failure failed with: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package testkit
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/value"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// Store is an in-memory state store, the part of the Cloudstate proxy a
+// value entity gets its state loaded from. The states of versioned entities
+// are stored wrapped with their version and unwrapped when read.
+type Store struct {
+	// mu protects the map below.
+	mu     sync.RWMutex
+	states map[value.EntityID]*any.Any
+}
+
+func newStore() *Store {
+	return &Store{
+		states: make(map[value.EntityID]*any.Any),
+	}
+}
+
+// Set sets the state of the entity with the given id. States not already
+// of type *any.Any are serialized like value.Context.SetState does.
+func (s *Store) Set(id value.EntityID, state interface{}) error {
+	payload, err := marshalAny(state)
+	if err != nil {
+		return err
+	}
+	s.put(id, payload)
+	return nil
+}
+
+// Get returns the state of the entity with the given id, or nil if it
+// has none.
+func (s *Store) Get(id value.EntityID) *any.Any {
+	state, _, err := unwrapState(s.persisted(id))
+	if err != nil {
+		return nil
+	}
+	return state
+}
+
+// Version returns the version of the state of the versioned entity with
+// the given id, or zero if it has none.
+func (s *Store) Version(id value.EntityID) int64 {
+	_, version, _ := unwrapState(s.persisted(id))
+	return version
+}
+
+// Unmarshal unmarshals the state of the entity with the given id into p.
+func (s *Store) Unmarshal(id value.EntityID, p proto.Message) error {
+	state, _, err := unwrapState(s.persisted(id))
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return fmt.Errorf("no state stored for entity %q", id)
+	}
+	return encoding.UnmarshalAny(state, p)
+}
+
+// Delete deletes the state of the entity with the given id.
+func (s *Store) Delete(id value.EntityID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, id)
+}
+
+// persisted returns the state of the entity with the given id as persisted,
+// wrapped with its version for a versioned entity.
+func (s *Store) persisted(id value.EntityID) *any.Any {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.states[id]
+}
+
+func (s *Store) put(id value.EntityID, state *any.Any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[id] = state
+}
+
+func marshalAny(i interface{}) (*any.Any, error) {
+	switch s := i.(type) {
+	case *any.Any:
+		return s, nil
+	case proto.Message:
+		return encoding.MarshalAny(s)
+	default:
+		return encoding.MarshalJSON(s)
+	}
+}
+
+// unwrapState returns the state and version wrapped by a persisted
+// value.VersionedState, or the persisted state itself if it is not wrapped.
+func unwrapState(persisted *any.Any) (*any.Any, int64, error) {
+	if persisted.GetTypeUrl() != versionedTypeURL {
+		return persisted, 0, nil
+	}
+	v := &value.VersionedState{}
+	if err := encoding.UnmarshalAny(persisted, v); err != nil {
+		return nil, 0, fmt.Errorf("decoding of the versioned state failed: %w", err)
+	}
+	return v.GetState(), v.GetVersion(), nil
+}
+
+var versionedTypeURL = encoding.ProtoAnyBase + "/cloudstate.value.VersionedState"
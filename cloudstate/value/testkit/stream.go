@@ -0,0 +1,24 @@
+package testkit
+
+import (
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/internal/teststream"
+)
+
+// stream is the entity.ValueEntity_HandleServer of a connection to the
+// stream handler of a value.Server.
+type stream struct {
+	*teststream.ServerStream
+}
+
+func (s stream) Send(out *entity.ValueEntityStreamOut) error {
+	return s.ServerStream.Send(out)
+}
+
+func (s stream) Recv() (*entity.ValueEntityStreamIn, error) {
+	in, err := s.ServerStream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return in.(*entity.ValueEntityStreamIn), nil
+}
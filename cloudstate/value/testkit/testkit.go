@@ -0,0 +1,214 @@
+// Package testkit drives a value.Entity in-memory, without a Cloudstate
+// proxy and without gRPC.
+//
+// A TestKit keeps a Store of the states of the entities. Commands are sent
+// to an Instance of an entity, which is loaded with its state from the store
+// the same way the proxy would load it. Passivating an instance and loading
+// it again reloads the entity through HandleState.
+package testkit
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/internal/teststream"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/cloudstateio/go-support/cloudstate/value"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// ErrPassivated is returned for commands sent to a passivated instance.
+var ErrPassivated = teststream.ErrPassivated
+
+// TestKit runs a value entity against an in-memory state store.
+type TestKit struct {
+	entity *value.Entity
+	server *value.Server
+	store  *Store
+}
+
+// New returns a TestKit for the given entity. The entity gets registered
+// the same way a CloudState instance does.
+func New(e *value.Entity) (*TestKit, error) {
+	server := value.NewServer()
+	if err := server.Register(e); err != nil {
+		return nil, err
+	}
+	return &TestKit{
+		entity: e,
+		server: server,
+		store:  newStore(),
+	}, nil
+}
+
+// Store returns the state store of the test kit.
+func (tk *TestKit) Store() *Store {
+	return tk.store
+}
+
+// Load starts an instance of the entity with the given id and loads it
+// with its stored state, if any.
+func (tk *TestKit) Load(id value.EntityID) (*Instance, error) {
+	i := &Instance{
+		id: id,
+		tk: tk,
+		conn: teststream.Open(func(s *teststream.ServerStream) error {
+			return tk.server.Handle(stream{s})
+		}),
+	}
+	init := &entity.ValueEntityInit{
+		ServiceName: tk.entity.ServiceName.String(),
+		EntityId:    string(id),
+	}
+	if state := tk.store.persisted(id); state != nil {
+		init.State = &entity.ValueEntityInitState{Value: state}
+	}
+	if err := i.conn.Send(&entity.ValueEntityStreamIn{
+		Message: &entity.ValueEntityStreamIn_Init{Init: init},
+	}); err != nil {
+		i.conn.Close()
+		return nil, err
+	}
+	return i, nil
+}
+
+// Instance is a running instance of a value entity.
+// Load failures are reported by the first command sent to it.
+type Instance struct {
+	id        value.EntityID
+	tk        *TestKit
+	conn      *teststream.Conn
+	commandID int64
+}
+
+// Command sends a command to the entity instance and returns its result.
+// State updates and deletes are applied to the store unless the command
+// failed. An error is returned if the entity failed the stream, after which
+// the instance is not usable anymore.
+func (i *Instance) Command(name string, cmd proto.Message) (*Result, error) {
+	return i.CommandWithMetadata(name, cmd, nil)
+}
+
+// CommandWithMetadata sends a command with metadata to the entity instance
+// and returns its result, like Command does.
+func (i *Instance) CommandWithMetadata(name string, cmd proto.Message, md *protocol.Metadata) (*Result, error) {
+	payload, err := marshalAny(cmd)
+	if err != nil {
+		return nil, err
+	}
+	i.commandID++
+	if err := i.conn.Send(&entity.ValueEntityStreamIn{
+		Message: &entity.ValueEntityStreamIn_Command{
+			Command: &protocol.Command{
+				EntityId: string(i.id),
+				Id:       i.commandID,
+				Name:     name,
+				Payload:  payload,
+				Metadata: md,
+			},
+		},
+	}); err != nil {
+		return nil, err
+	}
+	out, err := i.conn.Recv()
+	if err != nil {
+		return nil, err
+	}
+	switch m := out.(*entity.ValueEntityStreamOut).GetMessage().(type) {
+	case *entity.ValueEntityStreamOut_Reply:
+		r, persisted, err := resultFor(m.Reply)
+		if err != nil {
+			return nil, err
+		}
+		if r.Failure == nil {
+			switch {
+			case persisted != nil:
+				i.tk.store.put(i.id, persisted)
+			case r.Deleted:
+				i.tk.store.Delete(i.id)
+			}
+		}
+		return r, nil
+	case *entity.ValueEntityStreamOut_Failure:
+		return nil, i.conn.Fail(m.Failure)
+	default:
+		return nil, fmt.Errorf("unexpected message received: %+v", m)
+	}
+}
+
+// Passivate closes the stream of the instance, as the proxy does when
+// the entity gets passivated, and waits for the entity to stop.
+func (i *Instance) Passivate() error {
+	return i.conn.Passivate()
+}
+
+// Result is the outcome of a command handled by an entity instance.
+type Result struct {
+	// Reply is the reply payload, if the command was replied to.
+	Reply *any.Any
+	// Metadata is the reply metadata, if the command was replied to.
+	Metadata *protocol.Metadata
+	// Forward is set if the command was forwarded.
+	Forward *protocol.Forward
+	// Failure is set if the command failed.
+	Failure *protocol.Failure
+	// State is set if the command updated the state. For a versioned entity
+	// it is the state unwrapped from the value.VersionedState persisted.
+	State *any.Any
+	// Version is the version of the state persisted by a versioned entity.
+	Version int64
+	// Deleted is set if the command deleted the state.
+	Deleted bool
+	// SideEffects are the side effects emitted by the command handler.
+	SideEffects []*protocol.SideEffect
+}
+
+// resultFor returns the result for a reply and the state to be persisted
+// by the reply, if any.
+func resultFor(reply *entity.ValueEntityReply) (*Result, *any.Any, error) {
+	r := &Result{
+		SideEffects: reply.GetSideEffects(),
+	}
+	switch a := reply.GetClientAction().GetAction().(type) {
+	case *protocol.ClientAction_Reply:
+		r.Reply = a.Reply.GetPayload()
+		r.Metadata = a.Reply.GetMetadata()
+	case *protocol.ClientAction_Forward:
+		r.Forward = a.Forward
+	case *protocol.ClientAction_Failure:
+		r.Failure = a.Failure
+	}
+	var persisted *any.Any
+	switch a := reply.GetStateAction().GetAction().(type) {
+	case *entity.ValueEntityAction_Update:
+		persisted = a.Update.GetValue()
+		state, version, err := unwrapState(persisted)
+		if err != nil {
+			return nil, nil, err
+		}
+		// A versioned entity deletes its state by a tombstone.
+		r.State, r.Version, r.Deleted = state, version, state == nil
+	case *entity.ValueEntityAction_Delete:
+		r.Deleted = true
+	}
+	return r, persisted, nil
+}
+
+// UnmarshalReply unmarshals the reply payload into p.
+func (r *Result) UnmarshalReply(p proto.Message) error {
+	if r.Reply == nil {
+		return errors.New("the command was not replied to")
+	}
+	return encoding.UnmarshalAny(r.Reply, p)
+}
+
+// UnmarshalState unmarshals the updated state into p.
+func (r *Result) UnmarshalState(p proto.Message) error {
+	if r.State == nil {
+		return errors.New("the command did not update the state")
+	}
+	return encoding.UnmarshalAny(r.State, p)
+}
@@ -0,0 +1,225 @@
+package testkit
+
+import (
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/cloudstateio/go-support/cloudstate/value"
+	"github.com/cloudstateio/go-support/example/valueentity"
+	domain "github.com/cloudstateio/go-support/example/valueentity/persistence"
+)
+
+func newTestKit(t *testing.T) *TestKit {
+	t.Helper()
+	return newTestKitFor(t, false)
+}
+
+func newTestKitFor(t *testing.T, versioned bool) *TestKit {
+	t.Helper()
+	tk, err := New(&value.Entity{
+		ServiceName:   "com.example.valueentity.shoppingcart.ShoppingCart",
+		PersistenceID: "shopping-cart",
+		EntityFunc:    valueentity.NewShoppingCart,
+		StateFunc:     valueentity.NewState,
+		Versioned:     versioned,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tk
+}
+
+func load(t *testing.T, tk *TestKit, id value.EntityID) *Instance {
+	t.Helper()
+	i, err := tk.Load(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
+
+func addItem(t *testing.T, i *Instance, productID string, quantity int32) *Result {
+	t.Helper()
+	r, err := i.Command("AddItem", &valueentity.AddLineItem{
+		UserId: "user1", ProductId: productID, Name: productID, Quantity: quantity,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func getCart(t *testing.T, i *Instance) *valueentity.Cart {
+	t.Helper()
+	r, err := i.Command("GetCart", &valueentity.GetShoppingCart{UserId: "user1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cart := &valueentity.Cart{}
+	if err := r.UnmarshalReply(cart); err != nil {
+		t.Fatal(err)
+	}
+	return cart
+}
+
+func TestTestKit(t *testing.T) {
+	t.Run("a command should reply and update the state", func(t *testing.T) {
+		tk := newTestKit(t)
+		i := load(t, tk, "cart-1")
+		defer i.Passivate()
+		r := addItem(t, i, "bike", 2)
+		if r.Failure != nil {
+			t.Fatalf("unexpected failure: %+v", r.Failure)
+		}
+		state := &domain.Cart{}
+		if err := r.UnmarshalState(state); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := state.GetItems()[0].GetQuantity(), int32(2); got != want {
+			t.Fatalf("state.Items[0].Quantity = %d; want: %d", got, want)
+		}
+		stored := &domain.Cart{}
+		if err := tk.Store().Unmarshal("cart-1", stored); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(stored.GetItems()), 1; got != want {
+			t.Fatalf("len(stored.Items) = %d; want: %d", got, want)
+		}
+	})
+
+	t.Run("a failed command should not update the state", func(t *testing.T) {
+		tk := newTestKit(t)
+		i := load(t, tk, "cart-1")
+		defer i.Passivate()
+		r := addItem(t, i, "bike", -1)
+		if r.Failure == nil {
+			t.Fatal("r.Failure = nil; want a failure")
+		}
+		if r.State != nil || tk.Store().Get("cart-1") != nil {
+			t.Fatal("the state should not have been updated")
+		}
+	})
+
+	t.Run("an entity should be reloaded with its state", func(t *testing.T) {
+		tk := newTestKit(t)
+		i := load(t, tk, "cart-1")
+		addItem(t, i, "bike", 1)
+		addItem(t, i, "scooter", 1)
+		if err := i.Passivate(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := i.Command("GetCart", &valueentity.GetShoppingCart{UserId: "user1"}); err != ErrPassivated {
+			t.Fatalf("err = %v; want: %v", err, ErrPassivated)
+		}
+		i = load(t, tk, "cart-1")
+		defer i.Passivate()
+		if got, want := len(getCart(t, i).GetItems()), 2; got != want {
+			t.Fatalf("len(cart.Items) = %d; want: %d", got, want)
+		}
+	})
+
+	t.Run("a deleted state should be removed from the store", func(t *testing.T) {
+		tk := newTestKit(t)
+		i := load(t, tk, "cart-1")
+		addItem(t, i, "bike", 1)
+		r, err := i.Command("RemoveCart", &valueentity.RemoveShoppingCart{UserId: "user1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !r.Deleted {
+			t.Fatal("r.Deleted = false; want: true")
+		}
+		if tk.Store().Get("cart-1") != nil {
+			t.Fatal("the state should have been deleted")
+		}
+		if err := i.Passivate(); err != nil {
+			t.Fatal(err)
+		}
+		i = load(t, tk, "cart-1")
+		defer i.Passivate()
+		if got, want := len(getCart(t, i).GetItems()), 0; got != want {
+			t.Fatalf("len(cart.Items) = %d; want: %d", got, want)
+		}
+	})
+
+	t.Run("a store can be seeded with a state", func(t *testing.T) {
+		tk := newTestKit(t)
+		err := tk.Store().Set("cart-1", &domain.Cart{Items: []*domain.LineItem{
+			{ProductId: "bike", Name: "bike", Quantity: 3},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		i := load(t, tk, "cart-1")
+		defer i.Passivate()
+		cart := getCart(t, i)
+		if got, want := cart.GetItems()[0].GetQuantity(), int32(3); got != want {
+			t.Fatalf("cart.Items[0].Quantity = %d; want: %d", got, want)
+		}
+	})
+
+	t.Run("command metadata should be replied", func(t *testing.T) {
+		tk := newTestKit(t)
+		i := load(t, tk, "cart-1")
+		defer i.Passivate()
+		md := &protocol.Metadata{Entries: []*protocol.MetadataEntry{
+			{Key: "header", Value: &protocol.MetadataEntry_StringValue{StringValue: "value"}},
+		}}
+		r, err := i.CommandWithMetadata("GetCart", &valueentity.GetShoppingCart{UserId: "user1"}, md)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(r.Metadata.GetEntries()), 1; got != want {
+			t.Fatalf("len(r.Metadata.Entries) = %d; want: %d", got, want)
+		}
+	})
+}
+
+func TestTestKitVersioned(t *testing.T) {
+	tk := newTestKitFor(t, true)
+	i := load(t, tk, "cart-1")
+	r := addItem(t, i, "bike", 2)
+	if got, want := r.Version, int64(1); got != want {
+		t.Fatalf("r.Version = %d; want: %d", got, want)
+	}
+	state := &domain.Cart{}
+	if err := r.UnmarshalState(state); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := state.GetItems()[0].GetQuantity(), int32(2); got != want {
+		t.Fatalf("state.Items[0].Quantity = %d; want: %d", got, want)
+	}
+	stored := &domain.Cart{}
+	if err := tk.Store().Unmarshal("cart-1", stored); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(stored.GetItems()), 1; got != want {
+		t.Fatalf("len(stored.Items) = %d; want: %d", got, want)
+	}
+
+	r, err := i.Command("RemoveCart", &valueentity.RemoveShoppingCart{UserId: "user1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Deleted || r.State != nil {
+		t.Fatalf("r.Deleted, r.State = %v, %v; want: true, nil", r.Deleted, r.State)
+	}
+	if tk.Store().Get("cart-1") != nil {
+		t.Fatal("the state should have been deleted")
+	}
+	if got, want := tk.Store().Version("cart-1"), int64(2); got != want {
+		t.Fatalf("Store().Version() = %d; want: %d", got, want)
+	}
+	if err := i.Passivate(); err != nil {
+		t.Fatal(err)
+	}
+
+	i = load(t, tk, "cart-1")
+	defer i.Passivate()
+	if got, want := len(getCart(t, i).GetItems()), 0; got != want {
+		t.Fatalf("len(cart.Items) = %d; want: %d", got, want)
+	}
+	if got, want := addItem(t, i, "scooter", 1).Version, int64(3); got != want {
+		t.Fatalf("r.Version = %d; want: %d", got, want)
+	}
+}
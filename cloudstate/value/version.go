@@ -0,0 +1,123 @@
+package value
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// Metadata keys used for versioned entities.
+const (
+	// IfMatchKey is the command metadata key of the version a command
+	// expects the state to have. The wildcard "*" expects any state.
+	IfMatchKey = "if-match"
+	// ETagKey is the reply metadata key of the version of the state.
+	ETagKey = "etag"
+)
+
+// Version returns the version of the state of a versioned entity. The
+// version is incremented by every command updating or deleting the state
+// and zero if the state was never set.
+func (c *Context) Version() int64 {
+	return c.version
+}
+
+// unwrapState sets the state and version from a persisted state. A state
+// wrapped with its version is unwrapped whether the entity is versioned or
+// not, so that an entity no longer versioned reads the states persisted
+// before.
+func (c *Context) unwrapState(state *any.Any) error {
+	c.version = 0
+	c.state = state
+	if state.GetTypeUrl() != versionedTypeURL {
+		return nil
+	}
+	v := &VersionedState{}
+	if err := encoding.UnmarshalAny(state, v); err != nil {
+		return fmt.Errorf("decoding of the versioned state failed: %w", err)
+	}
+	c.version = v.GetVersion()
+	c.state = v.GetState()
+	return nil
+}
+
+// persistedState returns the state to be persisted on update or delete,
+// wrapped with its new version for a versioned entity. The state of a
+// versioned entity being deleted is persisted as a tombstone, a
+// VersionedState without a state, so that versions keep increasing if the
+// state is set again later.
+func (c *Context) persistedState() (*any.Any, error) {
+	if !c.Entity.Versioned {
+		return c.state, nil
+	}
+	return encoding.MarshalAny(&VersionedState{
+		Version: c.version + 1,
+		State:   c.state,
+	})
+}
+
+// checkVersion returns a client error if a command expects a version
+// different to the version of the state.
+func (c *Context) checkVersion(md *protocol.Metadata) error {
+	if !c.Entity.Versioned {
+		return nil
+	}
+	for _, e := range md.GetEntries() {
+		if !strings.EqualFold(e.GetKey(), IfMatchKey) {
+			continue
+		}
+		expected := e.GetStringValue()
+		if expected == "*" {
+			if c.state == nil {
+				return protocol.ClientError{Err: fmt.Errorf("precondition failed: expected a state, but there is none")}
+			}
+			return nil
+		}
+		version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(expected, "W/"), `"`), 10, 64)
+		if err != nil {
+			return protocol.ClientError{Err: fmt.Errorf("precondition failed: invalid version %q", expected)}
+		}
+		if version != c.version {
+			return protocol.ClientError{Err: fmt.Errorf("precondition failed: expected version %d, but is %d", version, c.version)}
+		}
+	}
+	return nil
+}
+
+// replyMetadataFor returns the metadata to be replied, the commands
+// metadata with the reply metadata set taking precedence and with the ETag
+// of the resulting version for a versioned entity.
+func (c *Context) replyMetadataFor(command *protocol.Command) *protocol.Metadata {
+	metadata := protocol.MergeMetadata(c.replyMetadata, command.GetMetadata())
+	if !c.Entity.Versioned {
+		return metadata
+	}
+	version := c.version
+	if c.failure == nil && (c.update || c.delete) {
+		version++
+	}
+	md := &protocol.Metadata{}
+	for _, e := range metadata.GetEntries() {
+		if !strings.EqualFold(e.GetKey(), IfMatchKey) && !strings.EqualFold(e.GetKey(), ETagKey) {
+			md.Entries = append(md.Entries, e)
+		}
+	}
+	md.Entries = append(md.Entries, &protocol.MetadataEntry{
+		Key:   ETagKey,
+		Value: &protocol.MetadataEntry_StringValue{StringValue: strconv.Quote(strconv.FormatInt(version, 10))},
+	})
+	return md
+}
+
+// commitVersion sets the version after a command was replied to.
+func (c *Context) commitVersion() {
+	if c.failure == nil && (c.update || c.delete) {
+		c.version++
+	}
+}
+
+const versionedTypeURL = encoding.ProtoAnyBase + "/cloudstate.value.VersionedState"
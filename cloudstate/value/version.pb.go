@@ -0,0 +1,188 @@
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The state persisted by versioned value entities.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.25.0
+// 	protoc        v3.11.2
+// source: cloudstate/value/version.proto
+
+package value
+
+import (
+	proto "github.com/golang/protobuf/proto"
+	any "github.com/golang/protobuf/ptypes/any"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// This is a compile-time assertion that a sufficiently up-to-date version
+// of the legacy proto package is being used.
+const _ = proto.ProtoPackageIsVersion4
+
+// VersionedState wraps the state of a versioned value entity with its version.
+// A deleted state is persisted without a state, as a tombstone keeping the
+// version.
+type VersionedState struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The version of the state, incremented by every update and delete.
+	Version int64 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	// The state, unset if the state was deleted.
+	State *any.Any `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
+}
+
+func (x *VersionedState) Reset() {
+	*x = VersionedState{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cloudstate_value_version_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *VersionedState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VersionedState) ProtoMessage() {}
+
+func (x *VersionedState) ProtoReflect() protoreflect.Message {
+	mi := &file_cloudstate_value_version_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VersionedState.ProtoReflect.Descriptor instead.
+func (*VersionedState) Descriptor() ([]byte, []int) {
+	return file_cloudstate_value_version_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *VersionedState) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *VersionedState) GetState() *any.Any {
+	if x != nil {
+		return x.State
+	}
+	return nil
+}
+
+var File_cloudstate_value_version_proto protoreflect.FileDescriptor
+
+var file_cloudstate_value_version_proto_rawDesc = []byte{
+	0x0a, 0x1e, 0x63, 0x6c, 0x6f, 0x75, 0x64, 0x73, 0x74, 0x61, 0x74, 0x65, 0x2f, 0x76, 0x61, 0x6c,
+	0x75, 0x65, 0x2f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x12, 0x10, 0x63, 0x6c, 0x6f, 0x75, 0x64, 0x73, 0x74, 0x61, 0x74, 0x65, 0x2e, 0x76, 0x61, 0x6c,
+	0x75, 0x65, 0x1a, 0x19, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x75, 0x66, 0x2f, 0x61, 0x6e, 0x79, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x56, 0x0a,
+	0x0e, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x65, 0x64, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12,
+	0x18, 0x0a, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x2a, 0x0a, 0x05, 0x73, 0x74, 0x61,
+	0x74, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x41, 0x6e, 0x79, 0x52, 0x05,
+	0x73, 0x74, 0x61, 0x74, 0x65, 0x42, 0x3b, 0x5a, 0x39, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e,
+	0x63, 0x6f, 0x6d, 0x2f, 0x63, 0x6c, 0x6f, 0x75, 0x64, 0x73, 0x74, 0x61, 0x74, 0x65, 0x69, 0x6f,
+	0x2f, 0x67, 0x6f, 0x2d, 0x73, 0x75, 0x70, 0x70, 0x6f, 0x72, 0x74, 0x2f, 0x63, 0x6c, 0x6f, 0x75,
+	0x64, 0x73, 0x74, 0x61, 0x74, 0x65, 0x2f, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3b, 0x76, 0x61, 0x6c,
+	0x75, 0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_cloudstate_value_version_proto_rawDescOnce sync.Once
+	file_cloudstate_value_version_proto_rawDescData = file_cloudstate_value_version_proto_rawDesc
+)
+
+func file_cloudstate_value_version_proto_rawDescGZIP() []byte {
+	file_cloudstate_value_version_proto_rawDescOnce.Do(func() {
+		file_cloudstate_value_version_proto_rawDescData = protoimpl.X.CompressGZIP(file_cloudstate_value_version_proto_rawDescData)
+	})
+	return file_cloudstate_value_version_proto_rawDescData
+}
+
+var file_cloudstate_value_version_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_cloudstate_value_version_proto_goTypes = []interface{}{
+	(*VersionedState)(nil), // 0: cloudstate.value.VersionedState
+	(*any.Any)(nil),        // 1: google.protobuf.Any
+}
+var file_cloudstate_value_version_proto_depIdxs = []int32{
+	1, // 0: cloudstate.value.VersionedState.state:type_name -> google.protobuf.Any
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_cloudstate_value_version_proto_init() }
+func file_cloudstate_value_version_proto_init() {
+	if File_cloudstate_value_version_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_cloudstate_value_version_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*VersionedState); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_cloudstate_value_version_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_cloudstate_value_version_proto_goTypes,
+		DependencyIndexes: file_cloudstate_value_version_proto_depIdxs,
+		MessageInfos:      file_cloudstate_value_version_proto_msgTypes,
+	}.Build()
+	File_cloudstate_value_version_proto = out.File
+	file_cloudstate_value_version_proto_rawDesc = nil
+	file_cloudstate_value_version_proto_goTypes = nil
+	file_cloudstate_value_version_proto_depIdxs = nil
+}
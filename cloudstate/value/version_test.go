@@ -0,0 +1,194 @@
+package value
+
+import (
+	"testing"
+
+	"github.com/cloudstateio/go-support/cloudstate/encoding"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func newVersionedServer(t *testing.T) *Server {
+	t.Helper()
+	server := NewServer()
+	err := server.Register(&Entity{
+		ServiceName: "failing",
+		EntityFunc: func(EntityID) EntityHandler {
+			return failingEntity{}
+		},
+		StateFunc: func() interface{} { return &wrappers.StringValue{} },
+		Versioned: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func ifMatch(s *stream, command int, version string) {
+	s.in[command].GetCommand().Metadata = &protocol.Metadata{Entries: []*protocol.MetadataEntry{{
+		Key:   IfMatchKey,
+		Value: &protocol.MetadataEntry_StringValue{StringValue: version},
+	}}}
+}
+
+func etag(t *testing.T, out *entity.ValueEntityStreamOut) string {
+	t.Helper()
+	for _, e := range out.GetReply().GetClientAction().GetReply().GetMetadata().GetEntries() {
+		if e.GetKey() == ETagKey {
+			return e.GetStringValue()
+		}
+	}
+	t.Fatalf("no etag replied: %+v", out)
+	return ""
+}
+
+func TestVersionedState(t *testing.T) {
+	t.Run("updates increment the version", func(t *testing.T) {
+		s := newStream(t, "Reply", "Reply")
+		ifMatch(s, 2, `"1"`)
+		if err := newVersionedServer(t).Handle(s); err != nil {
+			t.Fatal(err)
+		}
+		for i, want := range []string{`"1"`, `"2"`} {
+			if got := etag(t, s.sent[i]); got != want {
+				t.Fatalf("%d: etag = %s; want: %s", i, got, want)
+			}
+		}
+		c := &Context{Entity: &Entity{Versioned: true}}
+		if err := c.unwrapState(s.sent[1].GetReply().GetStateAction().GetUpdate().GetValue()); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := c.Version(), int64(2); got != want {
+			t.Fatalf("Version() = %d; want: %d", got, want)
+		}
+		state := &wrappers.StringValue{}
+		if err := encoding.UnmarshalAny(c.state, state); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := state.GetValue(), "Reply"; got != want {
+			t.Fatalf("state = %q; want: %q", got, want)
+		}
+	})
+
+	t.Run("a version mismatch fails the command", func(t *testing.T) {
+		s := newStream(t, "Reply", "Reply", "Reply")
+		ifMatch(s, 2, `"5"`)
+		ifMatch(s, 3, `W/"1"`)
+		if err := newVersionedServer(t).Handle(s); err != nil {
+			t.Fatal(err)
+		}
+		reply := s.sent[1].GetReply()
+		if reply.GetClientAction().GetFailure() == nil {
+			t.Fatal("a client action failure should have been sent")
+		}
+		if reply.GetStateAction() != nil {
+			t.Fatal("a failed command should not update the state")
+		}
+		if got, want := etag(t, s.sent[2]), `"2"`; got != want {
+			t.Fatalf("etag = %s; want: %s", got, want)
+		}
+	})
+
+	t.Run("the version is recovered from the persisted state", func(t *testing.T) {
+		state, err := encoding.MarshalAny(&wrappers.StringValue{Value: "initial"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		persisted, err := encoding.MarshalAny(&VersionedState{Version: 3, State: state})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newStream(t, "Reply")
+		s.in[0].GetInit().State = &entity.ValueEntityInitState{Value: persisted}
+		ifMatch(s, 1, `"3"`)
+		if err := newVersionedServer(t).Handle(s); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := etag(t, s.sent[0]), `"4"`; got != want {
+			t.Fatalf("etag = %s; want: %s", got, want)
+		}
+	})
+
+	t.Run("a wildcard expects a state", func(t *testing.T) {
+		s := newStream(t, "Reply", "Reply", "Reply")
+		ifMatch(s, 1, "*")
+		ifMatch(s, 3, "*")
+		if err := newVersionedServer(t).Handle(s); err != nil {
+			t.Fatal(err)
+		}
+		if s.sent[0].GetReply().GetClientAction().GetFailure() == nil {
+			t.Fatal("a client action failure should have been sent")
+		}
+		if got, want := etag(t, s.sent[2]), `"2"`; got != want {
+			t.Fatalf("etag = %s; want: %s", got, want)
+		}
+	})
+
+	t.Run("a delete persists a tombstone keeping the version", func(t *testing.T) {
+		s := newStream(t, "Reply", "Delete", "Reply")
+		ifMatch(s, 3, `"2"`)
+		if err := newVersionedServer(t).Handle(s); err != nil {
+			t.Fatal(err)
+		}
+		for i, want := range []string{`"1"`, `"2"`, `"3"`} {
+			if got := etag(t, s.sent[i]); got != want {
+				t.Fatalf("%d: etag = %s; want: %s", i, got, want)
+			}
+		}
+		tombstone := s.sent[1].GetReply().GetStateAction().GetUpdate().GetValue()
+		if tombstone == nil {
+			t.Fatal("a delete should update the state with a tombstone")
+		}
+		c := &Context{Entity: &Entity{Versioned: true}}
+		if err := c.unwrapState(tombstone); err != nil {
+			t.Fatal(err)
+		}
+		if c.state != nil {
+			t.Fatalf("state = %v; want: nil", c.state)
+		}
+		if got, want := c.Version(), int64(2); got != want {
+			t.Fatalf("Version() = %d; want: %d", got, want)
+		}
+	})
+
+	t.Run("a tombstone is recovered without a state", func(t *testing.T) {
+		persisted, err := encoding.MarshalAny(&VersionedState{Version: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newStream(t, "Reply", "Reply")
+		s.in[0].GetInit().State = &entity.ValueEntityInitState{Value: persisted}
+		ifMatch(s, 1, "*")
+		ifMatch(s, 2, `"5"`)
+		if err := newVersionedServer(t).Handle(s); err != nil {
+			t.Fatal(err)
+		}
+		if s.sent[0].GetReply().GetClientAction().GetFailure() == nil {
+			t.Fatal("a client action failure should have been sent")
+		}
+		if got, want := etag(t, s.sent[1]), `"6"`; got != want {
+			t.Fatalf("etag = %s; want: %s", got, want)
+		}
+	})
+
+	t.Run("a versioned state is unwrapped by an entity not versioned", func(t *testing.T) {
+		state, err := encoding.MarshalAny(&wrappers.StringValue{Value: "initial"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		persisted, err := encoding.MarshalAny(&VersionedState{Version: 3, State: state})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := &Context{Entity: &Entity{}}
+		if err := c.unwrapState(persisted); err != nil {
+			t.Fatal(err)
+		}
+		if !proto.Equal(c.state, state) {
+			t.Fatalf("state = %v; want: %v", c.state, state)
+		}
+	})
+}
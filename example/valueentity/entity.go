@@ -42,8 +42,7 @@ func (sc *ShoppingCart) AddItem(ctx *value.Context, item *AddLineItem) (*any.Any
 	if i, _ := sc.find(item.ProductId); i != nil {
 		i.Quantity += item.Quantity
 		sort.Sort(sortedCart(sc.cart))
-		c := &domain.Cart{Items: sc.cart}
-		if err := ctx.Update(encoding.MarshalAny(c)); err != nil {
+		if err := ctx.SetState(&domain.Cart{Items: sc.cart}); err != nil {
 			return nil, err
 		}
 		return encoding.MarshalAny(&empty.Empty{})
@@ -54,8 +53,7 @@ func (sc *ShoppingCart) AddItem(ctx *value.Context, item *AddLineItem) (*any.Any
 		Quantity:  item.Quantity,
 	})
 	sort.Sort(sortedCart(sc.cart))
-	c := &domain.Cart{Items: sc.cart}
-	if err := ctx.Update(encoding.MarshalAny(c)); err != nil {
+	if err := ctx.SetState(&domain.Cart{Items: sc.cart}); err != nil {
 		return nil, err
 	}
 	return encoding.MarshalAny(&empty.Empty{})
@@ -70,8 +68,7 @@ func (sc *ShoppingCart) RemoveItem(ctx *value.Context, item *RemoveLineItem) (*a
 		return nil, protocol.ClientError{errors.New("unable to remove product")}
 	}
 	sort.Sort(sortedCart(sc.cart))
-	c := &domain.Cart{Items: sc.cart}
-	if err := ctx.Update(encoding.MarshalAny(c)); err != nil {
+	if err := ctx.SetState(&domain.Cart{Items: sc.cart}); err != nil {
 		return nil, err
 	}
 	return encoding.MarshalAny(&empty.Empty{})
@@ -108,11 +105,21 @@ func (sc *ShoppingCart) HandleCommand(ctx *value.Context, name string, cmd proto
 	}
 }
 
-func (sc *ShoppingCart) HandleState(ctx *value.Context, state *any.Any) error {
-
+// HandleState sets the shopping cart from its persisted state.
+func (sc *ShoppingCart) HandleState(ctx *value.Context, _ *any.Any) error {
+	cart, ok := ctx.State().(*domain.Cart)
+	if !ok {
+		return fmt.Errorf("unexpected state type: %T", ctx.State())
+	}
+	sc.cart = cart.GetItems()
 	return nil
 }
 
+// NewState returns a new shopping cart state, the state type of the entity.
+func NewState() interface{} {
+	return &domain.Cart{}
+}
+
 // find finds a product in the shopping cart by productId and returns it as a LineItem.
 func (sc *ShoppingCart) find(productID string) (item *domain.LineItem, index int) {
 	for i, item := range sc.cart {
@@ -91,7 +91,6 @@ func (m *TestModel) HandleCommand(ctx *action.Context, name string, msg proto.Me
 		}
 	}
 	if name == "ProcessStreamedOut" || name == "ProcessStreamed" {
-		ctx.Cancel()
 		return nil
 	}
 	return failure
@@ -145,6 +145,7 @@ func main() {
 	err = server.RegisterValueEntity(&value.Entity{
 		ServiceName:   "com.example.valueentity.shoppingcart.ShoppingCart",
 		EntityFunc:    tck_value.NewShoppingCart,
+		StateFunc:     tck_value.NewState,
 		PersistenceID: "shopping-cart",
 	}, protocol.DescriptorConfig{
 		Service: "value_shoppingcart.proto",
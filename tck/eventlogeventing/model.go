@@ -17,13 +17,11 @@ type EventLogSubscriberModel struct {
 }
 
 func (e *EventLogSubscriberModel) HandleCommand(ctx *action.Context, name string, msg proto.Message) error {
-	var id = ""
-	for _, entry := range ctx.Metadata().GetEntries() {
-		if entry.GetKey() == "ce-subject" {
-			id = entry.GetStringValue()
-			break
-		}
+	ce, err := ctx.CloudEvent()
+	if err != nil {
+		return err
 	}
+	id := ce.Subject
 	switch name {
 	case "Effect":
 		r, err := encoding.MarshalAny(&Response{
@@ -49,32 +47,31 @@ func (e *EventLogSubscriberModel) HandleCommand(ctx *action.Context, name string
 		ctx.RespondWith(r)
 	case "ProcessEventOne":
 		one := msg.(*EventOne)
-		if err := convert(ctx, ctx.Metadata(), one.GetStep()); err != nil {
+		if err := convert(ctx, one.GetStep()); err != nil {
 			return err
 		}
-	case "ProcessEventTwo":
-		two := msg.(*EventTwo)
-		for _, step := range two.GetStep() {
-			err := convert(ctx, ctx.Metadata(), step)
-			if err != nil {
-				return err
-			}
-			if err = ctx.Respond(nil); err != nil {
-				return err
-			}
-		}
-		ctx.Cancel()
 	}
 	return nil
 }
 
-func convert(ctx *action.Context, metadata *protocol.Metadata, step *ProcessStep) error {
-	var id = ""
-	for _, entry := range metadata.GetEntries() {
-		if entry.GetKey() == "ce-subject" {
-			id = entry.GetStringValue()
+func (e *EventLogSubscriberModel) HandleStreamedOut(ctx *action.Context, name string, msg proto.Message, send action.SendFunc) error {
+	for _, step := range msg.(*EventTwo).GetStep() {
+		if err := convert(ctx, step); err != nil {
+			return err
+		}
+		if err := send(nil); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+func convert(ctx *action.Context, step *ProcessStep) error {
+	ce, err := ctx.CloudEvent()
+	if err != nil {
+		return err
+	}
+	id := ce.Subject
 	if step.GetReply() != nil {
 		x, err := encoding.MarshalAny(&Response{
 			Id:      id,
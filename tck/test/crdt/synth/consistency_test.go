@@ -0,0 +1,129 @@
+//
+// Copyright 2019 Lightbend Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudstateio/go-support/cloudstate/crdt"
+	"github.com/cloudstateio/go-support/cloudstate/entity"
+	"github.com/cloudstateio/go-support/cloudstate/protocol"
+	crdt2 "github.com/cloudstateio/go-support/tck/crdt"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// cancellingModel is the TCK model writing streamed commands with ALL and
+// incrementing its GCounter when a stream is cancelled, with LOCAL for keys
+// ending with "-local".
+type cancellingModel struct {
+	*crdt2.TestModel
+}
+
+func (m cancellingModel) HandleCommand(cc *crdt.CommandContext, name string, cmd proto.Message) (*any.Any, error) {
+	if cc.Streamed() {
+		cc.WriteConsistency(entity.CrdtWriteConsistency_ALL)
+		local := strings.HasSuffix(cmd.(*crdt2.GCounterRequest).GetId(), "-local")
+		cc.CancelFunc(func(c *crdt.CommandContext) error {
+			if local {
+				c.WriteConsistency(entity.CrdtWriteConsistency_LOCAL)
+			}
+			c.CRDT().(*crdt.GCounter).Increment(1)
+			return nil
+		})
+	}
+	return m.TestModel.HandleCommand(cc, name, cmd)
+}
+
+func TestCRDTWriteConsistency(t *testing.T) {
+	s := newServerFor(t, &crdt.Entity{
+		ServiceName: serviceName,
+		EntityFunc: func(id crdt.EntityID) crdt.EntityHandler {
+			return cancellingModel{crdt2.NewEntity(id)}
+		},
+		DefaultWriteConsistency: entity.CrdtWriteConsistency_MAJORITY,
+	})
+	defer s.teardown()
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	cancelStream := func(t *testing.T, p *proxy, entityID string, id int64) *entity.CrdtStateAction {
+		t.Helper()
+		err := p.Send(&entity.CrdtStreamIn{
+			Message: &entity.CrdtStreamIn_StreamCancelled{
+				StreamCancelled: &protocol.StreamCancelled{EntityId: entityID, Id: id},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := p.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := out.GetStreamCancelledResponse()
+		if response == nil {
+			t.Fatalf("a stream cancelled response should have been sent: %+v", out)
+		}
+		return response.GetStateAction()
+	}
+
+	t.Run("a command emits state actions with the default write consistency", func(t *testing.T) {
+		tr := tester{t}
+		entityID := "gcounter-wc-0"
+		p := newProxy(ctx, s)
+		defer p.teardown()
+		p.init(&entity.CrdtInit{ServiceName: serviceName, EntityId: entityID})
+		stateAction := p.command(entityID, "ProcessGCounter",
+			gcounterRequest(&crdt2.GCounterIncrement{Key: entityID, Value: 1}),
+		).GetReply().GetStateAction()
+		tr.expectedNotNil(stateAction.GetUpdate())
+		tr.expectedString(stateAction.GetWriteConsistency().String(), entity.CrdtWriteConsistency_MAJORITY.String())
+	})
+
+	t.Run("a command and its cancel handler choose their write consistency independently", func(t *testing.T) {
+		tr := tester{t}
+		entityID := "gcounter-wc-1"
+		p := newProxy(ctx, s)
+		defer p.teardown()
+		p.init(&entity.CrdtInit{ServiceName: serviceName, EntityId: entityID})
+		stateAction := p.commandStreamed(entityID, "ProcessGCounterStreamed",
+			gcounterRequest(&crdt2.GCounterIncrement{Key: entityID, Value: 1}),
+		).GetReply().GetStateAction()
+		tr.expectedString(stateAction.GetWriteConsistency().String(), entity.CrdtWriteConsistency_ALL.String())
+
+		stateAction = cancelStream(t, p, entityID, p.seq-1)
+		tr.expectedUInt64(stateAction.GetUpdate().GetGcounter().GetIncrement(), 1)
+		tr.expectedString(stateAction.GetWriteConsistency().String(), entity.CrdtWriteConsistency_MAJORITY.String())
+	})
+
+	t.Run("a cancel handler overrides the default write consistency", func(t *testing.T) {
+		tr := tester{t}
+		entityID := "gcounter-wc-local"
+		p := newProxy(ctx, s)
+		defer p.teardown()
+		p.init(&entity.CrdtInit{ServiceName: serviceName, EntityId: entityID})
+		p.commandStreamed(entityID, "ProcessGCounterStreamed",
+			gcounterRequest(&crdt2.GCounterIncrement{Key: entityID, Value: 1}),
+		)
+		stateAction := cancelStream(t, p, entityID, p.seq-1)
+		tr.expectedUInt64(stateAction.GetUpdate().GetGcounter().GetIncrement(), 1)
+		tr.expectedString(stateAction.GetWriteConsistency().String(), entity.CrdtWriteConsistency_LOCAL.String())
+	})
+}
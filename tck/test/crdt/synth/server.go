@@ -41,6 +41,18 @@ type server struct {
 }
 
 func newServer(t *testing.T) *server {
+	t.Helper()
+	return newServerFor(t, &crdt.Entity{
+		ServiceName: serviceName, // this is the package + service(name) from the gRPC proto file.
+		EntityFunc: func(id crdt.EntityID) crdt.EntityHandler {
+			return crdt2.NewEntity(id)
+		},
+	})
+}
+
+// newServerFor returns a server with the entity e registered for the TCK
+// CRDT service.
+func newServerFor(t *testing.T, e *crdt.Entity) *server {
 	t.Helper()
 	s := server{t: t}
 	if s.t == nil {
@@ -55,12 +67,7 @@ func newServer(t *testing.T) *server {
 	}
 	s.server = server
 	err = server.RegisterCRDT(
-		&crdt.Entity{
-			ServiceName: serviceName, // this is the package + service(name) from the gRPC proto file.
-			EntityFunc: func(id crdt.EntityID) crdt.EntityHandler {
-				return crdt2.NewEntity(id)
-			},
-		},
+		e,
 		protocol.DescriptorConfig{
 			Service: "tck_crdt.proto", // this is needed to find the descriptors with got for the service to be proxied.
 		},